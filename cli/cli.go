@@ -18,6 +18,10 @@ var (
 	taskFileFlag string
 	kbFlag       string
 	modelFlag    string
+	recordFlag   string
+	replayFlag   string
+	planFlag     bool
+	dryRunFlag   bool
 )
 
 var rootCmd = &cobra.Command{
@@ -65,12 +69,45 @@ var rootCmd = &cobra.Command{
 			mgr.LoadKBsFromCLI(kbNames)
 		}
 
+		// Record or replay the AI traffic from CLI flags
+		if recordFlag != "" || replayFlag != "" {
+			var cassette *internal.Cassette
+			if recordFlag != "" && replayFlag != "" {
+				err = fmt.Errorf("--record and --replay cannot be used together")
+			} else if recordFlag != "" {
+				cassette, err = internal.NewRecordingCassette(recordFlag)
+			} else {
+				cassette, err = internal.NewReplayCassette(replayFlag)
+			}
+			if err != nil {
+				logger.Error("Error setting up cassette: %v", err)
+				fmt.Fprintf(os.Stderr, "Error setting up cassette: %v\n", err)
+				os.Exit(1)
+			}
+			mgr.SetCassette(cassette)
+		}
+
 		// Set model from CLI flag
 		if modelFlag != "" {
 			mgr.SetModelsDefault(modelFlag)
 			logger.Info("Set model from CLI flag: %s", modelFlag)
 		}
 
+		// Show the actions without sending anything to the panes
+		if dryRunFlag {
+			mgr.DryRun = true
+			logger.Info("Dry run enabled from CLI flag")
+		}
+
+		// Plan the initial request instead of running it right away
+		if planFlag {
+			if initMessage == "" {
+				fmt.Fprintln(os.Stderr, "--plan requires a request message or --file")
+				os.Exit(1)
+			}
+			initMessage = "/plan " + initMessage
+		}
+
 		if initMessage != "" {
 			logger.Info("Starting with initial subcommand: %s", initMessage)
 		}
@@ -86,6 +123,10 @@ func init() {
 	rootCmd.Flags().StringVarP(&taskFileFlag, "file", "f", "", "Read request from specified file")
 	rootCmd.Flags().StringVar(&kbFlag, "kb", "", "Comma-separated list of knowledge bases to load (e.g., --kb docker,git)")
 	rootCmd.Flags().StringVar(&modelFlag, "model", "", "AI model configuration to use (e.g., --model gpt4)")
+	rootCmd.Flags().StringVar(&recordFlag, "record", "", "Record all AI requests and responses to a directory")
+	rootCmd.Flags().StringVar(&replayFlag, "replay", "", "Replay AI responses recorded with --record from a directory")
+	rootCmd.Flags().BoolVar(&planFlag, "plan", false, "Plan the request step by step and review the plan before running it")
+	rootCmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Show the actions the AI would take without sending anything to the panes")
 	rootCmd.Flags().BoolP("version", "v", false, "Print version information")
 }
 
@@ -1,12 +1,19 @@
 package config
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -18,6 +25,9 @@ type Config struct {
 	MaxCaptureLines       int                   `mapstructure:"max_capture_lines"`
 	MaxContextSize        int                   `mapstructure:"max_context_size"`
 	WaitInterval          int                   `mapstructure:"wait_interval"`
+	MaxSteps              int                   `mapstructure:"max_steps"`   // steps of the agent loop per request
+	MaxRetries            int                   `mapstructure:"max_retries"` // guideline retries per request
+	MaxBusyWaits          int                   `mapstructure:"max_busy_waits"` // waits for a busy exec pane per request
 	SendKeysConfirm       bool                  `mapstructure:"send_keys_confirm"`
 	PasteMultilineConfirm bool                  `mapstructure:"paste_multiline_confirm"`
 	ExecConfirm           bool                  `mapstructure:"exec_confirm"`
@@ -28,12 +38,18 @@ type Config struct {
 	AzureOpenAI           AzureOpenAIConfig     `mapstructure:"azure_openai"`
 	DefaultModel          string                 `mapstructure:"default_model"`
 	Models                map[string]ModelConfig  `mapstructure:"models"`
+	FallbackModels        []string              `mapstructure:"fallback_models"`
+	ModelRoles            ModelRoles            `mapstructure:"model_roles"`
+	SessionBudget         float64               `mapstructure:"session_budget"` // USD, 0 means no limit
+	DailyBudget           float64               `mapstructure:"daily_budget"`   // USD, 0 means no limit
 	Prompts               PromptsConfig         `mapstructure:"prompts"`
 	Personas              map[string]*Persona   `mapstructure:"personas"`
 	PersonaRules          []PersonaRule         `mapstructure:"persona_rules"`
 	DefaultPersona        string                `mapstructure:"default_persona"`
 	ToolsManifestPath     string                `mapstructure:"tools_manifest_path"`
 	KnowledgeBase         KnowledgeBaseConfig   `mapstructure:"knowledge_base"`
+	Hooks                 HooksConfig           `mapstructure:"hooks"`
+	WritablePanes         []string              `mapstructure:"writable_panes"`
 }
 
 // OpenRouterConfig holds OpenRouter API configuration
@@ -59,17 +75,88 @@ type AzureOpenAIConfig struct {
 }
 
 
+// HooksConfig holds shell commands run around agent actions, each gets the event as JSON on stdin.
+// A pre hook exiting non-zero vetoes the action. It only rewrites the action when it prints
+// a JSON reply, {"command": "..."} for pre_exec or {"keys": [...]} for pre_send_keys.
+type HooksConfig struct {
+	PreExec               string `mapstructure:"pre_exec"`
+	PostExec              string `mapstructure:"post_exec"`
+	PreSendKeys           string `mapstructure:"pre_send_keys"`
+	OnResponse            string `mapstructure:"on_response"`
+	OnRequestAccomplished string `mapstructure:"on_request_accomplished"`
+	OnError               string `mapstructure:"on_error"`
+}
+
+// ModelRoles maps the kinds of work to entries of models, a role left empty uses the chat model
+type ModelRoles struct {
+	Chat      string `mapstructure:"chat"`      // the conversation, takes the place of default_model
+	Watch     string `mapstructure:"watch"`     // watch mode
+	Summarize string `mapstructure:"summarize"` // squashing the chat history
+	Reflect   string `mapstructure:"reflect"`   // reflecting on executed commands
+}
+
 // ModelConfig holds a single model configuration
 type ModelConfig struct {
-	Provider string `mapstructure:"provider"`
+	Provider string `mapstructure:"provider"` // openrouter, openai, azure, anthropic, ollama, mock
 	Model   string `mapstructure:"model"`
 	APIKey  string `mapstructure:"api_key"`
 	BaseURL string `mapstructure:"base_url"`
 
+	// Alternatives to a plaintext api_key, resolved on first use and cached for the session
+	APIKeyCommand string `mapstructure:"api_key_command"` // shell command printing the key, e.g. "pass show openai"
+	APIKeyFile    string `mapstructure:"api_key_file"`    // file containing the key
+
+	// Extra HTTP headers sent with every request, these override the default ones such as HTTP-Referer
+	Headers map[string]string `mapstructure:"headers"`
+
+	// Limits in tokens, known models get these from a built-in table
+	ContextWindow int `mapstructure:"context_window"` // drives when the history is squashed
+	MaxOutput     int `mapstructure:"max_output"`
+	Tokenizer     string `mapstructure:"tokenizer"` // cl100k_base, o200k_base or heuristic
+
+	// Attempts per request including retries of rate limits and server errors, 0 means default
+	MaxAttempts int `mapstructure:"max_attempts"`
+
+	// Connection settings, each distinct combination gets its own HTTP client
+	ConnectTimeout  time.Duration `mapstructure:"connect_timeout"`  // dial and TLS handshake, default 30s
+	ResponseTimeout time.Duration `mapstructure:"response_timeout"` // wait for the response headers, default 5m
+	Proxy           string        `mapstructure:"proxy"`            // HTTP(S) proxy URL, defaults to HTTPS_PROXY/HTTP_PROXY
+	CACert          string        `mapstructure:"ca_cert"`          // PEM bundle trusted in addition to the system roots
+	ClientCert      string        `mapstructure:"client_cert"`      // PEM client certificate for mutual TLS
+	ClientKey       string        `mapstructure:"client_key"`
+
+	// Sampling parameters, unset ones are left to the provider defaults
+	Temperature     *float64 `mapstructure:"temperature"`
+	TopP            *float64 `mapstructure:"top_p"`
+	MaxTokens       int      `mapstructure:"max_tokens"`
+	Stop            []string `mapstructure:"stop"`
+	ReasoningEffort string   `mapstructure:"reasoning_effort"` // minimal, low, medium, high
+
+	// Request summaries of the model's reasoning and show them dimmed above its answer:
+	// auto, concise or detailed for OpenAI, any of them for OpenRouter
+	ReasoningSummary string `mapstructure:"reasoning_summary"`
+
+	// How actions are requested: "xml" tags in the text (default) or "native" tool calls
+	ToolCalling string `mapstructure:"tool_calling"`
+
+	// OpenAI Responses API only: resend the full conversation every turn instead of storing it on the server
+	Stateless bool `mapstructure:"stateless"`
+
+	// Pricing in USD per million tokens, used for cost accounting and budgets
+	InputPrice  float64 `mapstructure:"input_price"`
+	OutputPrice float64 `mapstructure:"output_price"`
+
 	// Azure-specific fields
 	APIBase        string `mapstructure:"api_base"`
 	APIVersion     string `mapstructure:"api_version"`
 	DeploymentName string `mapstructure:"deployment_name"`
+
+	// Ollama-specific fields
+	KeepAlive string `mapstructure:"keep_alive"` // how long the model stays loaded, e.g. "10m"
+	NumCtx    int    `mapstructure:"num_ctx"`    // context window size passed as options.num_ctx
+
+	// Mock-specific fields
+	Script string `mapstructure:"script"` // YAML or JSONL file with the scripted responses
 }
 
 // PromptsConfig holds customizable prompt templates
@@ -78,6 +165,7 @@ type PromptsConfig struct {
 	ChatAssistant         string `mapstructure:"chat_assistant"`
 	ChatAssistantPrepared string `mapstructure:"chat_assistant_prepared"`
 	Watch                 string `mapstructure:"watch"`
+	Plan                  string `mapstructure:"plan"`
 }
 
 // Persona represents a single persona configuration
@@ -141,8 +229,11 @@ Discipline:
 	return &Config{
 		Debug:                 false,
 		MaxCaptureLines:       200,
-		MaxContextSize:        100000,
+		MaxContextSize:        0, // the model's context window, see GetMaxContextSize
 		WaitInterval:          5,
+		MaxSteps:              30,
+		MaxRetries:            3,
+		MaxBusyWaits:          60,
 		SendKeysConfirm:       true,
 		PasteMultilineConfirm: true,
 		ExecConfirm:           true,
@@ -218,6 +309,10 @@ func Load() (*Config, error) {
 
 	ResolveEnvKeyInConfig(config)
 
+	if err := validateWritablePanes(config.WritablePanes); err != nil {
+		return nil, err
+	}
+
 	// Load personas from directory
 	configDir, _ = GetConfigDir()
 	personasDir := filepath.Join(configDir, "personas")
@@ -239,6 +334,23 @@ func Load() (*Config, error) {
 	return config, nil
 }
 
+var paneIdRegex = regexp.MustCompile(`^%\d+$`)
+
+// ValidPaneID reports whether id is a tmux pane id, such as %2
+func ValidPaneID(id string) bool {
+	return paneIdRegex.MatchString(id)
+}
+
+// validateWritablePanes checks that writable_panes lists tmux pane ids
+func validateWritablePanes(panes []string) error {
+	for _, id := range panes {
+		if !ValidPaneID(id) {
+			return fmt.Errorf("invalid pane id %q in writable_panes, pane ids look like %%2", id)
+		}
+	}
+	return nil
+}
+
 // EnumerateConfigKeys returns all config keys (dot notation) for the given struct type.
 func EnumerateConfigKeys(cfgType reflect.Type, prefix string) []string {
 	var keys []string
@@ -477,6 +589,10 @@ func inferConfigFieldType(t reflect.Type, parts []string, value string) (any, bo
 			if fieldType.Kind() == reflect.Struct {
 				return inferConfigFieldType(fieldType, parts[1:], value)
 			}
+			// models.<name>.<field>, the next part is the map key
+			if fieldType.Kind() == reflect.Map && fieldType.Elem().Kind() == reflect.Struct && len(parts) > 2 {
+				return inferConfigFieldType(fieldType.Elem(), parts[2:], value)
+			}
 			return value, false
 		}
 
@@ -503,6 +619,13 @@ func inferConfigFieldType(t reflect.Type, parts []string, value string) (any, bo
 					return int64(parsed), true
 				}
 			}
+		case reflect.Float32, reflect.Float64:
+			if parsed, err := strconv.ParseFloat(value, fieldType.Bits()); err == nil {
+				if fieldType.Kind() == reflect.Float32 {
+					return float32(parsed), true
+				}
+				return parsed, true
+			}
 		}
 
 		return value, false
@@ -525,9 +648,131 @@ func resolveEnvKeyReferenceInValue(val reflect.Value) {
 		for i := 0; i < val.NumField(); i++ {
 			resolveEnvKeyReferenceInValue(val.Field(i))
 		}
+	case reflect.Map:
+		// Map values aren't addressable, so each one is resolved on a copy and stored back.
+		// Only string and struct values are resolved, which covers models and their headers.
+		elemKind := val.Type().Elem().Kind()
+		if elemKind != reflect.String && elemKind != reflect.Struct {
+			return
+		}
+		iter := val.MapRange()
+		for iter.Next() {
+			elem := reflect.New(val.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			resolveEnvKeyReferenceInValue(elem)
+			val.SetMapIndex(iter.Key(), elem)
+		}
 	case reflect.Ptr:
 		if !val.IsNil() {
 			resolveEnvKeyReferenceInValue(val.Elem())
 		}
 	}
 }
+
+const apiKeyCommandTimeout = 30 * time.Second
+
+// apiKeyEntry is an API key resolved, or being resolved, from a command or file, done is closed once it is known
+type apiKeyEntry struct {
+	done chan struct{}
+	key  string
+	err  error
+}
+
+var (
+	apiKeyCache   = make(map[string]*apiKeyEntry)
+	apiKeyCacheMu sync.Mutex
+)
+
+// HasAPIKey reports whether the model has an API key, either inline or from a command or file
+func (mc ModelConfig) HasAPIKey() bool {
+	return mc.APIKey != "" || mc.APIKeyCommand != "" || mc.APIKeyFile != ""
+}
+
+// ResolveAPIKey returns the API key of a model. An inline api_key takes precedence, otherwise
+// api_key_command is run or api_key_file is read, once per session. Models sharing a command
+// wait for the same run, the lock is not held while it runs so other models aren't held up.
+func ResolveAPIKey(ctx context.Context, mc ModelConfig) (string, error) {
+	if mc.APIKey != "" || (mc.APIKeyCommand == "" && mc.APIKeyFile == "") {
+		return mc.APIKey, nil
+	}
+
+	cacheKey := "file:" + mc.APIKeyFile
+	if mc.APIKeyCommand != "" {
+		cacheKey = "command:" + mc.APIKeyCommand
+	}
+
+	for {
+		apiKeyCacheMu.Lock()
+		entry, ok := apiKeyCache[cacheKey]
+		if !ok {
+			entry = &apiKeyEntry{done: make(chan struct{})}
+			apiKeyCache[cacheKey] = entry
+			apiKeyCacheMu.Unlock()
+
+			entry.key, entry.err = loadAPIKey(ctx, mc)
+			if entry.err != nil {
+				// failures are not cached, the next request tries again
+				apiKeyCacheMu.Lock()
+				delete(apiKeyCache, cacheKey)
+				apiKeyCacheMu.Unlock()
+			}
+			close(entry.done)
+			return entry.key, entry.err
+		}
+		apiKeyCacheMu.Unlock()
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		// the run was canceled with the request that started it, not this one: run it again
+		if entry.err != nil && errors.Is(entry.err, context.Canceled) && ctx.Err() == nil {
+			continue
+		}
+		return entry.key, entry.err
+	}
+}
+
+// loadAPIKey runs api_key_command or reads api_key_file
+func loadAPIKey(ctx context.Context, mc ModelConfig) (string, error) {
+	var key string
+	source := "api_key_file"
+	if mc.APIKeyCommand != "" {
+		source = "api_key_command"
+		ctx, cancel := context.WithTimeout(ctx, apiKeyCommandTimeout)
+		defer cancel()
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sh", "-c", mc.APIKeyCommand)
+		cmd.Stderr = &stderr
+		// children of the shell may keep its output open after it was killed
+		cmd.WaitDelay = time.Second
+		out, err := cmd.Output()
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", fmt.Errorf("api_key_command failed: %w: %s", err, msg)
+			}
+			return "", fmt.Errorf("api_key_command failed: %w", err)
+		}
+		key = strings.TrimSpace(string(out))
+	} else {
+		path := mc.APIKeyFile
+		if strings.HasPrefix(path, "~/") {
+			if homeDir, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(homeDir, path[2:])
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read api_key_file: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	if key == "" {
+		return "", fmt.Errorf("empty API key from %s", source)
+	}
+	return key, nil
+}
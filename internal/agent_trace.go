@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StepOutcome tells how a step of the agent loop ended and what the loop does next
+type StepOutcome string
+
+const (
+	StepContinue       StepOutcome = "continue"         // actions were taken, the updated panes are sent next
+	StepBusy           StepOutcome = "busy"             // the exec pane was busy, it is checked again after waiting
+	StepRetry          StepOutcome = "retry"            // the AI did not follow the guidelines and is asked again
+	StepSquashed       StepOutcome = "squashed"         // the context overflowed, the request is resent with a squashed history
+	StepAccomplished   StepOutcome = "accomplished"     // the request is done
+	StepWaitingForUser StepOutcome = "waiting_for_user" // the AI needs an answer from the user
+	StepNoComment      StepOutcome = "no_comment"       // watch mode found nothing to say
+	StepCommented      StepOutcome = "commented"        // watch mode commented, it looks at the panes again later
+	StepDeclined       StepOutcome = "declined"         // the user declined an action
+	StepVetoed         StepOutcome = "vetoed"           // a pre hook vetoed an action
+	StepCanceled       StepOutcome = "canceled"
+	StepFailed         StepOutcome = "failed"          // the request or parsing its response failed
+	StepBudgetExceeded StepOutcome = "budget_exceeded" // max_steps, max_retries, max_busy_waits or the spend budget ran out
+)
+
+// StepAction is an action the AI asked for during a step
+type StepAction struct {
+	Kind     string // exec, send_keys or paste
+	Content  string // the command as run, keys or pasted text
+	Pane     string // the pane it was sent to, empty for the exec pane
+	Executed bool   // false when the user declined it
+	DryRun   bool   // shown but not sent to the pane, see /dryrun
+}
+
+// AgentStep is the trace of one step of the agent loop: a request to the AI and what came of it
+type AgentStep struct {
+	Number   int
+	Request  string // the message sent, without the pane contents
+	Model    string // model that answered
+	Response AIResponse
+	Actions  []StepAction
+	Outcome  StepOutcome
+	Err      error
+	Started  time.Time
+	Duration time.Duration
+}
+
+// String summarizes the step on one line, for logs
+func (s AgentStep) String() string {
+	var actions []string
+	for _, action := range s.Actions {
+		status := "run"
+		switch {
+		case action.DryRun:
+			status = "dry run"
+		case !action.Executed:
+			status = "declined"
+		}
+		if action.Pane != "" {
+			status += " in pane " + action.Pane
+		}
+		actions = append(actions, fmt.Sprintf("%s(%s) %s", action.Kind, action.Content, status))
+	}
+	line := fmt.Sprintf("step %d: %s in %s", s.Number, s.Outcome, s.Duration.Round(time.Millisecond))
+	if len(actions) > 0 {
+		line += ", actions: " + strings.Join(actions, ", ")
+	}
+	if s.Err != nil {
+		line += ", error: " + s.Err.Error()
+	}
+	return line
+}
@@ -0,0 +1,294 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+const (
+	anthropicDefaultBaseURL   = "https://api.anthropic.com"
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 8192
+)
+
+// AnthropicMessage represents a message in the Anthropic Messages API
+type AnthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// AnthropicRequest represents a request to the Anthropic Messages API
+type AnthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []AnthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Stream        bool               `json:"stream,omitempty"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+}
+
+// AnthropicContentBlock represents a content block in an Anthropic response
+type AnthropicContentBlock struct {
+	Type string `json:"type"` // "text", "thinking", "tool_use", etc.
+	Text string `json:"text,omitempty"`
+}
+
+// AnthropicUsage represents token usage in the Anthropic Messages API
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicError represents an error returned by the Anthropic Messages API
+type AnthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// AnthropicResponse represents a response from the Anthropic Messages API
+type AnthropicResponse struct {
+	ID         string                  `json:"id"`
+	Type       string                  `json:"type"` // "message" or "error"
+	Role       string                  `json:"role"`
+	Model      string                  `json:"model"`
+	Content    []AnthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      *AnthropicUsage         `json:"usage,omitempty"`
+	Error      *AnthropicError         `json:"error,omitempty"`
+}
+
+// AnthropicStreamEvent represents a server-sent event of a streamed Anthropic Messages API call
+type AnthropicStreamEvent struct {
+	Type    string             `json:"type"` // "content_block_delta", "message_stop", "error", etc.
+	Index   int                `json:"index"`
+	Delta   *AnthropicDelta    `json:"delta,omitempty"`
+	Message *AnthropicResponse `json:"message,omitempty"` // sent with "message_start", carries the input tokens
+	Usage   *AnthropicUsage    `json:"usage,omitempty"`   // sent with "message_delta", carries the output tokens
+	Error   *AnthropicError    `json:"error,omitempty"`
+}
+
+// AnthropicDelta represents the delta of a streamed content block
+type AnthropicDelta struct {
+	Type string `json:"type"` // "text_delta", "thinking_delta", etc.
+	Text string `json:"text,omitempty"`
+}
+
+// toAnthropicMessages splits messages into the top-level system prompt and the conversation.
+// Anything sent before the first user message (system prompt, knowledge bases) becomes part
+// of the system prompt, since the Messages API expects the conversation to start with a user turn.
+func toAnthropicMessages(messages []Message) (string, []AnthropicMessage) {
+	var system []string
+	var conversation []AnthropicMessage
+
+	for _, msg := range messages {
+		if msg.Role == "system" || (len(conversation) == 0 && msg.Role != "user") {
+			system = append(system, msg.Content)
+			continue
+		}
+		conversation = append(conversation, AnthropicMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+
+	return strings.Join(system, "\n\n"), conversation
+}
+
+// AnthropicMessages sends a request to the Anthropic Messages API
+func (c *AiClient) AnthropicMessages(ctx context.Context, messages []Message, model string) (string, error) {
+	system, conversation := toAnthropicMessages(messages)
+	if len(conversation) == 0 {
+		return "", fmt.Errorf("only system message provided, no user message to process")
+	}
+
+	onDelta := streamHandlerFromContext(ctx)
+	reqBody := AnthropicRequest{
+		Model:     model,
+		System:    system,
+		Messages:  conversation,
+		MaxTokens: anthropicDefaultMaxTokens,
+		Stream:    onDelta != nil,
+	}
+
+	// Get model configuration for Anthropic
+	var apiKey string
+	var baseURL string
+	var headers map[string]string
+
+	if c.configMgr != nil {
+		if modelConfig, exists := c.currentModelConfig(ctx); exists && modelConfig.Provider == "anthropic" {
+			key, err := config.ResolveAPIKey(ctx, modelConfig)
+			if err != nil {
+				logger.Error("Failed to resolve API key: %v", err)
+				return "", err
+			}
+			apiKey = key
+			headers = modelConfig.Headers
+			baseURL = modelConfig.BaseURL
+
+			reqBody.Temperature = modelConfig.Temperature
+			reqBody.TopP = modelConfig.TopP
+			reqBody.StopSequences = modelConfig.Stop
+			if modelConfig.MaxTokens > 0 {
+				reqBody.MaxTokens = modelConfig.MaxTokens
+			} else if maxOutput := modelCapabilities(modelConfig).MaxOutput; maxOutput > 0 && maxOutput < reqBody.MaxTokens {
+				reqBody.MaxTokens = maxOutput
+			}
+		}
+	}
+
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+	url := strings.TrimSuffix(baseURL, "/v1") + "/v1/messages"
+
+	reqJSON, err := json.Marshal(reqBody)
+	if err != nil {
+		logger.Error("Failed to marshal Anthropic request: %v", err)
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqJSON))
+	if err != nil {
+		logger.Error("Failed to create Anthropic request: %v", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	setHeaders(req, headers)
+
+	logger.Debug("Sending Anthropic API request to: %s with model: %s", url, model)
+
+	resp, err := c.doWithRetry(ctx, req)
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return "", fmt.Errorf("request canceled: %w", ctx.Err())
+		}
+		logger.Error("Failed to send Anthropic request: %v", err)
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusOK && onDelta != nil && isEventStream(resp) {
+		return c.readAnthropicStream(ctx, resp.Body, onDelta, model)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("Failed to read Anthropic response: %v", err)
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	logger.Debug("Anthropic API response status: %d, response size: %d bytes", resp.StatusCode, len(body))
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("Anthropic API returned error: %s", body)
+		return "", &APIStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var response AnthropicResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		logger.Error("Failed to unmarshal Anthropic response: %v, body: %s", err, body)
+		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if response.Error != nil {
+		logger.Error("Anthropic API returned error: %s", response.Error.Message)
+		return "", &APIError{Message: response.Error.Message}
+	}
+
+	if response.Usage != nil {
+		c.recordUsage(ctx, model, Usage{InputTokens: response.Usage.InputTokens, OutputTokens: response.Usage.OutputTokens})
+	}
+
+	var text strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	if text.Len() == 0 && response.StopReason == "refusal" {
+		logger.Error("Anthropic response refused (model: %s)", model)
+		return "", contentFilterError(model)
+	}
+
+	if text.Len() == 0 {
+		logger.Error("No text content returned. Raw response: %s", string(body))
+		return "", fmt.Errorf("no response content returned (model: %s, status: %d)", model, resp.StatusCode)
+	}
+
+	logger.Debug("Received Anthropic response (%d characters): %s", text.Len(), text.String())
+	return text.String(), nil
+}
+
+// readAnthropicStream accumulates a streamed Anthropic response, passing each text delta to onDelta
+func (c *AiClient) readAnthropicStream(ctx context.Context, body io.Reader, onDelta StreamHandler, model string) (string, error) {
+	var content strings.Builder
+	var usage Usage
+
+	err := readSSE(body, func(data string) error {
+		var event AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			logger.Error("Failed to unmarshal Anthropic stream event: %v, data: %s", err, data)
+			return fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil && event.Message.Usage != nil {
+				usage.InputTokens = event.Message.Usage.InputTokens
+			}
+		case "message_delta":
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "content_block_delta":
+			if event.Delta != nil && event.Delta.Type == "text_delta" {
+				content.WriteString(event.Delta.Text)
+				onDelta(event.Delta.Text)
+			}
+		case "message_stop":
+			return errStreamDone
+		case "error":
+			if event.Error != nil {
+				return &APIError{Message: event.Error.Message}
+			}
+			return &APIError{Message: data}
+		}
+		return nil
+	})
+	if err != nil && err != errStreamDone {
+		if ctx.Err() == context.Canceled {
+			return "", fmt.Errorf("request canceled: %w", ctx.Err())
+		}
+		logger.Error("Failed to read Anthropic stream: %v", err)
+		return "", err
+	}
+
+	if usage.TotalTokens() > 0 {
+		c.recordUsage(ctx, model, usage)
+	}
+
+	if content.Len() == 0 {
+		logger.Error("No content in streamed Anthropic response (model: %s)", model)
+		return "", fmt.Errorf("no response content returned (model: %s)", model)
+	}
+
+	logger.Debug("Received streamed Anthropic response (%d characters): %s", content.Len(), content.String())
+	return content.String(), nil
+}
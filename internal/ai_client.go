@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -9,35 +10,72 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alvinunreal/tmuxai/config"
 	"github.com/alvinunreal/tmuxai/logger"
 )
 
-// AiClient represents an AI client for interacting with OpenAI-compatible APIs including Azure OpenAI
+// AiClient represents an AI client for interacting with OpenAI-compatible APIs including Azure OpenAI and Anthropic
 type AiClient struct {
 	config      *config.Config
 	configMgr   *Manager  // To access model configuration methods
-	client      *http.Client
+	clients     map[string]*http.Client // per transport settings, see httpClient
+	clientsMu   sync.Mutex
+	mocks       map[string]*MockScript // mock provider scripts by path
+	mocksMu     sync.Mutex
+	cassette    *Cassette // records or replays all HTTP traffic when set
 }
 
 // Message represents a chat message
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 }
 
 // ChatCompletionRequest represents a request to the chat completion API
 type ChatCompletionRequest struct {
-	Model    string    `json:"model,omitempty"`
-	Messages []Message `json:"messages"`
+	Model         string                      `json:"model,omitempty"`
+	Messages      []Message                   `json:"messages"`
+	Stream        bool                        `json:"stream,omitempty"`
+	StreamOptions *ChatCompletionStreamOptions `json:"stream_options,omitempty"`
+	Tools         []interface{}               `json:"tools,omitempty"`
+
+	// Sampling parameters
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"top_p,omitempty"`
+	MaxTokens       int      `json:"max_tokens,omitempty"`
+	Stop            []string `json:"stop,omitempty"`
+	ReasoningEffort string   `json:"reasoning_effort,omitempty"`
+
+	// OpenRouter only: return the reasoning of reasoning models
+	Reasoning *ChatCompletionReasoning `json:"reasoning,omitempty"`
+}
+
+// ChatCompletionReasoning configures the reasoning tokens returned by OpenRouter
+type ChatCompletionReasoning struct {
+	Enabled bool `json:"enabled"`
+}
+
+// ChatCompletionStreamOptions asks for usage to be reported in the last chunk of a stream
+type ChatCompletionStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatCompletionMessage is a message received from the chat completion API.
+// The reasoning is only shown to the user, it is never part of a Message sent back.
+type ChatCompletionMessage struct {
+	Message
+	Reasoning string `json:"reasoning,omitempty"`
 }
 
 // ChatCompletionChoice represents a choice in the chat completion response
 type ChatCompletionChoice struct {
-	Index   int     `json:"index"`
-	Message Message `json:"message"`
+	Index        int                   `json:"index"`
+	Message      ChatCompletionMessage `json:"message"`
+	FinishReason string                `json:"finish_reason,omitempty"`
 }
 
 // ChatCompletionResponse represents a response from the chat completion API
@@ -46,6 +84,40 @@ type ChatCompletionResponse struct {
 	Object  string                 `json:"object"`
 	Created int64                  `json:"created"`
 	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   *ChatCompletionUsage   `json:"usage,omitempty"`
+}
+
+// ChatCompletionUsage represents token usage in the chat completion API
+type ChatCompletionUsage struct {
+	PromptTokens            int `json:"prompt_tokens"`
+	CompletionTokens        int `json:"completion_tokens"`
+	TotalTokens             int `json:"total_tokens"`
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details,omitempty"`
+}
+
+// usage converts the reported usage to the common format
+func (u *ChatCompletionUsage) usage() Usage {
+	usage := Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+	if u.CompletionTokensDetails != nil {
+		usage.ReasoningTokens = u.CompletionTokensDetails.ReasoningTokens
+	}
+	return usage
+}
+
+// ChatCompletionChunkChoice represents a choice in a streamed chat completion chunk
+type ChatCompletionChunkChoice struct {
+	Index        int                   `json:"index"`
+	Delta        ChatCompletionMessage `json:"delta"`
+	FinishReason string                `json:"finish_reason,omitempty"`
+}
+
+// ChatCompletionChunk represents a single server-sent event of a streamed chat completion
+type ChatCompletionChunk struct {
+	ID      string                      `json:"id"`
+	Choices []ChatCompletionChunkChoice `json:"choices"`
+	Usage   *ChatCompletionUsage        `json:"usage,omitempty"`
 }
 
 // Responses API Types
@@ -67,7 +139,12 @@ type ResponseOutputItem struct {
 	Status  string           `json:"status,omitempty"` // "completed", "in_progress", etc.
 	Content []ResponseContent `json:"content,omitempty"`
 	Role    string           `json:"role,omitempty"` // "assistant", "user", etc.
-	Summary []interface{}    `json:"summary,omitempty"`
+	Summary []ResponseContent `json:"summary,omitempty"` // reasoning items, requested with reasoning.summary
+
+	// Function call items
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
 }
 
 // ResponseRequest represents a request to the Responses API
@@ -80,6 +157,19 @@ type ResponseRequest struct {
 	Store         bool                   `json:"store,omitempty"`
 	Include       []string               `json:"include,omitempty"`
 	Text          map[string]interface{} `json:"text,omitempty"` // for structured outputs
+	Stream        bool                   `json:"stream,omitempty"`
+
+	// Sampling parameters
+	Temperature     *float64           `json:"temperature,omitempty"`
+	TopP            *float64           `json:"top_p,omitempty"`
+	MaxOutputTokens int                `json:"max_output_tokens,omitempty"`
+	Reasoning       *ResponseReasoning `json:"reasoning,omitempty"`
+}
+
+// ResponseReasoning configures reasoning models in the Responses API
+type ResponseReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"` // auto, concise or detailed
 }
 
 // Response represents a response from the Responses API
@@ -92,6 +182,9 @@ type Response struct {
 	OutputText        string               `json:"output_text,omitempty"`
 	Error             *ResponseError       `json:"error,omitempty"`
 	Usage             *ResponseUsage       `json:"usage,omitempty"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"` // "max_output_tokens" or "content_filter"
+	} `json:"incomplete_details,omitempty"`
 }
 
 // ResponseError represents an error in the Responses API
@@ -107,12 +200,66 @@ type ResponseUsage struct {
 	OutputTokens         int `json:"output_tokens"`
 	ReasoningTokens      int `json:"reasoning_tokens,omitempty"`
 	TotalTokens          int `json:"total_tokens"`
+	OutputTokensDetails  *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details,omitempty"`
+}
+
+// usage converts the reported usage to the common format
+func (u *ResponseUsage) usage() Usage {
+	usage := Usage{InputTokens: u.InputTokens, OutputTokens: u.OutputTokens, ReasoningTokens: u.ReasoningTokens}
+	if u.OutputTokensDetails != nil && u.OutputTokensDetails.ReasoningTokens > 0 {
+		usage.ReasoningTokens = u.OutputTokensDetails.ReasoningTokens
+	}
+	return usage
+}
+
+// ResponseStreamEvent represents a server-sent event of a streamed Responses API call
+type ResponseStreamEvent struct {
+	Type     string    `json:"type"` // "response.output_text.delta", "response.completed", etc.
+	Delta    string    `json:"delta,omitempty"`
+	Response *Response `json:"response,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
+
+// StreamHandler receives chunks of model output as they arrive
+type StreamHandler func(delta string)
+
+type streamHandlerKey struct{}
+
+// WithStreamHandler returns a context that makes the AI client request a streamed
+// response and pass every text delta to handler while the response is being read
+func WithStreamHandler(ctx context.Context, handler StreamHandler) context.Context {
+	return context.WithValue(ctx, streamHandlerKey{}, handler)
+}
+
+// streamHandlerFromContext returns the stream handler attached to ctx, if any
+func streamHandlerFromContext(ctx context.Context) StreamHandler {
+	if handler, ok := ctx.Value(streamHandlerKey{}).(StreamHandler); ok {
+		return handler
+	}
+	return nil
+}
+
+type reasoningHandlerKey struct{}
+
+// WithReasoningHandler returns a context that passes the reasoning summaries of the model to handler,
+// delta by delta when the response is streamed and all at once otherwise
+func WithReasoningHandler(ctx context.Context, handler StreamHandler) context.Context {
+	return context.WithValue(ctx, reasoningHandlerKey{}, handler)
+}
+
+// emitReasoning passes reasoning to the reasoning handler attached to ctx, if any
+func emitReasoning(ctx context.Context, reasoning string) {
+	if handler, ok := ctx.Value(reasoningHandlerKey{}).(StreamHandler); ok && reasoning != "" {
+		handler(reasoning)
+	}
 }
 
 func NewAiClient(cfg *config.Config) *AiClient {
 	return &AiClient{
-		config: cfg,
-		client: &http.Client{},
+		config:  cfg,
+		clients: make(map[string]*http.Client),
 	}
 }
 
@@ -121,16 +268,30 @@ func (c *AiClient) SetConfigManager(mgr *Manager) {
 	c.configMgr = mgr
 }
 
+// SetCassette makes the client record its HTTP traffic to, or replay it from, the cassette
+func (c *AiClient) SetCassette(cassette *Cassette) {
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+	c.cassette = cassette
+	c.clients = make(map[string]*http.Client)
+}
+
 // determineAPIType determines which API to use based on the model and configuration
-func (c *AiClient) determineAPIType(model string) string {
+func (c *AiClient) determineAPIType(ctx context.Context, model string) string {
 	// If we have a config manager, try to get the current model configuration
 	if c.configMgr != nil {
-		if modelConfig, exists := c.configMgr.GetCurrentModelConfig(); exists {
+		if modelConfig, exists := c.currentModelConfig(ctx); exists {
 			switch modelConfig.Provider {
 			case "openai":
 				return "responses"
 			case "azure":
 				return "azure"
+			case "anthropic":
+				return "anthropic"
+			case "ollama":
+				return "ollama"
+			case "mock":
+				return "mock"
 			case "openrouter":
 				return "openrouter"
 			default:
@@ -178,8 +339,13 @@ func (c *AiClient) GetResponseFromChatMessages(ctx context.Context, chatMessages
 
 	logger.Info("Sending %d messages to AI using model: %s", len(aiMessages), model)
 
+	return c.getResponseWithFallback(ctx, aiMessages, model)
+}
+
+// sendMessages routes the messages to the API of the model configuration in use
+func (c *AiClient) sendMessages(ctx context.Context, aiMessages []Message, model string) (string, error) {
 	// Determine which API to use
-	apiType := c.determineAPIType(model)
+	apiType := c.determineAPIType(ctx, model)
 	logger.Debug("Using API type: %s for model: %s", apiType, model)
 
 	// Route to appropriate API
@@ -191,6 +357,12 @@ func (c *AiClient) GetResponseFromChatMessages(ctx context.Context, chatMessages
 		response, err = c.Response(ctx, aiMessages, model)
 	case "azure":
 		response, err = c.ChatCompletion(ctx, aiMessages, model)
+	case "anthropic":
+		response, err = c.AnthropicMessages(ctx, aiMessages, model)
+	case "ollama":
+		response, err = c.OllamaChat(ctx, aiMessages, model)
+	case "mock":
+		response, err = c.MockChat(ctx, aiMessages, model)
 	case "openrouter":
 		response, err = c.ChatCompletion(ctx, aiMessages, model)
 	default:
@@ -206,9 +378,18 @@ func (c *AiClient) GetResponseFromChatMessages(ctx context.Context, chatMessages
 
 // ChatCompletion sends a chat completion request to the OpenRouter API
 func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model string) (string, error) {
+	onDelta := streamHandlerFromContext(ctx)
 	reqBody := ChatCompletionRequest{
 		Model:    model,
 		Messages: messages,
+		Stream:   onDelta != nil,
+	}
+	if reqBody.Stream {
+		reqBody.StreamOptions = &ChatCompletionStreamOptions{IncludeUsage: true}
+	}
+	tools := c.nativeToolSession(ctx)
+	if tools != nil {
+		reqBody.Tools = chatCompletionTools(tools.Tools)
 	}
 
 	// Get model configuration
@@ -218,16 +399,32 @@ func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model
 	var apiBase string
 	var apiVersion string
 	var deploymentName string
+	var headers map[string]string
 
 	// Try to get model configuration
 	if c.configMgr != nil {
-		if modelConfig, exists := c.configMgr.GetCurrentModelConfig(); exists {
+		if modelConfig, exists := c.currentModelConfig(ctx); exists {
+			key, err := config.ResolveAPIKey(ctx, modelConfig)
+			if err != nil {
+				logger.Error("Failed to resolve API key: %v", err)
+				return "", err
+			}
 			provider = modelConfig.Provider
-			apiKey = modelConfig.APIKey
+			apiKey = key
+			headers = modelConfig.Headers
 			baseURL = modelConfig.BaseURL
 			apiBase = modelConfig.APIBase
 			apiVersion = modelConfig.APIVersion
 			deploymentName = modelConfig.DeploymentName
+
+			reqBody.Temperature = modelConfig.Temperature
+			reqBody.TopP = modelConfig.TopP
+			reqBody.MaxTokens = modelConfig.MaxTokens
+			reqBody.Stop = modelConfig.Stop
+			reqBody.ReasoningEffort = modelConfig.ReasoningEffort
+			if modelConfig.ReasoningSummary != "" && modelConfig.Provider == "openrouter" {
+				reqBody.Reasoning = &ChatCompletionReasoning{Enabled: true}
+			}
 		}
 	}
 
@@ -290,12 +487,13 @@ func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model
 
 	req.Header.Set("HTTP-Referer", "https://github.com/alvinunreal/tmuxai")
 	req.Header.Set("X-Title", "TmuxAI")
+	setHeaders(req, headers)
 
 	// Log the request details for debugging before sending
 	logger.Debug("Sending API request to: %s with model: %s", url, model)
 
 	// Send the request
-	resp, err := c.client.Do(req)
+	resp, err := c.doWithRetry(ctx, req)
 	if err != nil {
 		if ctx.Err() == context.Canceled {
 			return "", fmt.Errorf("request canceled: %w", ctx.Err())
@@ -305,6 +503,10 @@ func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	if resp.StatusCode == http.StatusOK && onDelta != nil && isEventStream(resp) {
+		return c.readChatCompletionStream(ctx, resp.Body, onDelta, model)
+	}
+
 	// Read the response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -318,7 +520,7 @@ func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model
 	// Check for errors
 	if resp.StatusCode != http.StatusOK {
 		logger.Error("API returned error: %s", body)
-		return "", fmt.Errorf("API returned error: %s", body)
+		return "", &APIStatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	// Parse the response
@@ -328,9 +530,21 @@ func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model
 		return "", fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
+	if completionResp.Usage != nil {
+		c.recordUsage(ctx, model, completionResp.Usage.usage())
+	}
+
 	// Return the response content
 	if len(completionResp.Choices) > 0 {
+		if tools != nil {
+			tools.Calls = completionResp.Choices[0].Message.ToolCalls
+		}
+		emitReasoning(ctx, completionResp.Choices[0].Message.Reasoning)
 		responseContent := completionResp.Choices[0].Message.Content
+		if responseContent == "" && completionResp.Choices[0].FinishReason == "content_filter" {
+			logger.Error("Response blocked by content filter (model: %s)", model)
+			return "", contentFilterError(model)
+		}
 		logger.Debug("Received AI response (%d characters): %s", len(responseContent), responseContent)
 		return responseContent, nil
 	}
@@ -343,7 +557,7 @@ func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model
 // Response sends a request to the OpenAI Responses API
 func (c *AiClient) Response(ctx context.Context, messages []Message, model string) (string, error) {
 	// Convert messages to Responses API format
-	var input ResponseInput
+	var input []Message
 	var instructions string
 
 	if len(messages) == 0 {
@@ -363,22 +577,53 @@ func (c *AiClient) Response(ctx context.Context, messages []Message, model strin
 		input = messages
 	}
 
+	onDelta := streamHandlerFromContext(ctx)
 	reqBody := ResponseRequest{
 		Model:        model,
 		Input:        input,
 		Instructions: instructions,
 		Store:        false, // Default to stateless for better control over API usage and costs
+		Stream:       onDelta != nil,
+	}
+
+	// Stateful conversations only send what the stored previous response does not know yet
+	turn := c.responseTurnFor(ctx, model, instructions, input)
+	if turn != nil {
+		reqBody.Store = true
+		reqBody.PreviousResponseID = turn.PreviousID
+		reqBody.Input = turn.input()
+	}
+	tools := c.nativeToolSession(ctx)
+	if tools != nil {
+		reqBody.Tools = responsesTools(tools.Tools)
 	}
 
 	// Get model configuration for OpenAI
 	var apiKey string
 	var baseURL string
+	var headers map[string]string
 
 	// Try to get model configuration
 	if c.configMgr != nil {
-		if modelConfig, exists := c.configMgr.GetCurrentModelConfig(); exists && modelConfig.Provider == "openai" {
-			apiKey = modelConfig.APIKey
+		if modelConfig, exists := c.currentModelConfig(ctx); exists && modelConfig.Provider == "openai" {
+			key, err := config.ResolveAPIKey(ctx, modelConfig)
+			if err != nil {
+				logger.Error("Failed to resolve API key: %v", err)
+				return "", err
+			}
+			apiKey = key
+			headers = modelConfig.Headers
 			baseURL = modelConfig.BaseURL
+
+			reqBody.Temperature = modelConfig.Temperature
+			reqBody.TopP = modelConfig.TopP
+			reqBody.MaxOutputTokens = modelConfig.MaxTokens
+			if modelConfig.ReasoningEffort != "" || modelConfig.ReasoningSummary != "" {
+				reqBody.Reasoning = &ResponseReasoning{Effort: modelConfig.ReasoningEffort, Summary: modelConfig.ReasoningSummary}
+			}
+			if len(modelConfig.Stop) > 0 {
+				logger.Debug("Stop sequences are not supported by the Responses API, ignoring them")
+			}
 		}
 	}
 
@@ -415,12 +660,13 @@ func (c *AiClient) Response(ctx context.Context, messages []Message, model strin
 
 	req.Header.Set("HTTP-Referer", "https://github.com/alvinunreal/tmuxai")
 	req.Header.Set("X-Title", "TmuxAI")
+	setHeaders(req, headers)
 
 	// Log the request details for debugging before sending
 	logger.Debug("Sending Responses API request to: %s with model: %s", url, model)
 
 	// Send the request
-	resp, err := c.client.Do(req)
+	resp, err := c.doWithRetry(ctx, req)
 	if err != nil {
 		if ctx.Err() == context.Canceled {
 			return "", fmt.Errorf("request canceled: %w", ctx.Err())
@@ -430,6 +676,14 @@ func (c *AiClient) Response(ctx context.Context, messages []Message, model strin
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	if resp.StatusCode == http.StatusOK && onDelta != nil && isEventStream(resp) {
+		text, responseID, err := c.readResponseStream(ctx, resp.Body, onDelta, model)
+		if err == nil {
+			c.rememberResponse(turn, responseID, text, tools.calls())
+		}
+		return text, err
+	}
+
 	// Read the response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -443,7 +697,13 @@ func (c *AiClient) Response(ctx context.Context, messages []Message, model strin
 	// Check for errors
 	if resp.StatusCode != http.StatusOK {
 		logger.Error("Responses API returned error: %s", body)
-		return "", fmt.Errorf("API returned error: %s", body)
+		statusErr := &APIStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+		if isChainExpired(turn, statusErr) {
+			logger.Warn("Previous response %s is not available anymore, resending the full conversation", turn.PreviousID)
+			c.configMgr.resetResponseChain()
+			return c.Response(ctx, messages, model)
+		}
+		return "", statusErr
 	}
 
 	// Parse the response
@@ -456,33 +716,295 @@ func (c *AiClient) Response(ctx context.Context, messages []Message, model strin
 	// Check for API errors in response body
 	if response.Error != nil {
 		logger.Error("Responses API returned error: %s", response.Error.Message)
-		return "", fmt.Errorf("API error: %s", response.Error.Message)
+		return "", &APIError{Code: response.Error.Code, Message: response.Error.Message}
 	}
 
+	if response.Usage != nil {
+		c.recordUsage(ctx, model, response.Usage.usage())
+	}
+	if tools != nil {
+		tools.Calls = responseToolCalls(response)
+	}
+	emitReasoning(ctx, responseReasoningSummary(response))
+
 	// Return the response content
 	if response.OutputText != "" {
 		logger.Debug("Received Responses API response (%d characters): %s", len(response.OutputText), response.OutputText)
+		c.rememberResponse(turn, response.ID, response.OutputText, tools.calls())
 		return response.OutputText, nil
 	}
 
 	// If no output_text, extract from message items
+	if text := responseOutputText(response); text != "" {
+		logger.Debug("Received Responses API response from output items (%d characters): %s", len(text), text)
+		c.rememberResponse(turn, response.ID, text, tools.calls())
+		return text, nil
+	}
+
+	// A response may consist of tool calls only
+	if tools != nil && len(tools.Calls) > 0 {
+		logger.Debug("Received Responses API response with %d tool calls", len(tools.Calls))
+		c.rememberResponse(turn, response.ID, "", tools.Calls)
+		return "", nil
+	}
+
+	if response.IncompleteDetails != nil && response.IncompleteDetails.Reason == "content_filter" {
+		logger.Error("Responses API response blocked by content filter (model: %s)", model)
+		return "", contentFilterError(model)
+	}
+
+	// Enhanced error for no response content
+	logger.Error("No response content returned. Raw response: %s", string(body))
+	return "", fmt.Errorf("no response content returned (model: %s, status: %d)", model, resp.StatusCode)
+}
+
+// responseToolCalls extracts the function calls of a Responses API response
+func responseToolCalls(response Response) []ToolCall {
+	var calls []ToolCall
+	for _, item := range response.Output {
+		if item.Type == "function_call" {
+			calls = append(calls, ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: ToolCallFunction{Name: item.Name, Arguments: item.Arguments},
+			})
+		}
+	}
+	return calls
+}
+
+// responseReasoningSummary joins the summary parts of the reasoning items of a Responses API response
+func responseReasoningSummary(response Response) string {
+	var parts []string
+	for _, item := range response.Output {
+		if item.Type != "reasoning" {
+			continue
+		}
+		for _, summary := range item.Summary {
+			if text := strings.TrimSpace(summary.Text); text != "" {
+				parts = append(parts, text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// responseOutputText extracts the text of the first completed message item of a Responses API response
+func responseOutputText(response Response) string {
 	for _, item := range response.Output {
 		if item.Type == "message" && item.Status == "completed" {
 			for _, content := range item.Content {
 				if (content.Type == "output_text" || content.Type == "text") && content.Text != "" {
-					logger.Debug("Received Responses API response from output items (%d characters): %s", len(content.Text), content.Text)
-					return content.Text, nil
+					return content.Text
 				}
 			}
 		}
 	}
+	return ""
+}
 
-	// Enhanced error for no response content
-	logger.Error("No response content returned. Raw response: %s", string(body))
-	return "", fmt.Errorf("no response content returned (model: %s, status: %d)", model, resp.StatusCode)
+// isEventStream reports whether the response body is a server-sent event stream.
+// Some OpenAI compatible servers ignore "stream": true and answer with plain JSON.
+func isEventStream(resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+}
+
+// readSSE reads a server-sent event stream and calls fn with the data of every event
+func readSSE(body io.Reader, fn func(data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	var data strings.Builder
+	dispatch := func() error {
+		if data.Len() == 0 {
+			return nil
+		}
+		payload := data.String()
+		data.Reset()
+		return fn(payload)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// comment, used by some providers as keep-alive
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteString("\n")
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
+
+// errStreamDone stops reading a chat completion stream at the [DONE] sentinel
+var errStreamDone = fmt.Errorf("stream done")
+
+// readChatCompletionStream accumulates a streamed chat completion, passing each delta to onDelta
+func (c *AiClient) readChatCompletionStream(ctx context.Context, body io.Reader, onDelta StreamHandler, model string) (string, error) {
+	var content strings.Builder
+	toolCalls := toolCallAccumulator{}
+	var finishReason string
+
+	err := readSSE(body, func(data string) error {
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			logger.Error("Failed to unmarshal stream chunk: %v, data: %s", err, data)
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			c.recordUsage(ctx, model, chunk.Usage.usage())
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			for _, call := range choice.Delta.ToolCalls {
+				toolCalls.add(call)
+			}
+			emitReasoning(ctx, choice.Delta.Reasoning)
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+		return nil
+	})
+	if err != nil && err != errStreamDone {
+		if ctx.Err() == context.Canceled {
+			return "", fmt.Errorf("request canceled: %w", ctx.Err())
+		}
+		logger.Error("Failed to read response stream: %v", err)
+		return "", fmt.Errorf("failed to read response stream: %w", err)
+	}
+
+	if tools := c.nativeToolSession(ctx); tools != nil && len(toolCalls) > 0 {
+		tools.Calls = toolCalls.calls()
+		logger.Debug("Received %d streamed tool calls", len(tools.Calls))
+	} else if content.Len() == 0 && finishReason == "content_filter" {
+		logger.Error("Streamed response blocked by content filter (model: %s)", model)
+		return "", contentFilterError(model)
+	} else if content.Len() == 0 {
+		logger.Error("No content in streamed response (model: %s)", model)
+		return "", fmt.Errorf("no completion choices returned (model: %s)", model)
+	}
+
+	logger.Debug("Received streamed AI response (%d characters): %s", content.Len(), content.String())
+	return content.String(), nil
+}
+
+// readResponseStream accumulates a streamed Responses API call, passing each text delta to onDelta
+func (c *AiClient) readResponseStream(ctx context.Context, body io.Reader, onDelta StreamHandler, model string) (string, string, error) {
+	var content strings.Builder
+	var completed *Response
+	summarized := false
+
+	err := readSSE(body, func(data string) error {
+		var event ResponseStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			logger.Error("Failed to unmarshal Responses API stream event: %v, data: %s", err, data)
+			return fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "response.output_text.delta":
+			content.WriteString(event.Delta)
+			onDelta(event.Delta)
+		case "response.reasoning_summary_part.added":
+			if summarized {
+				emitReasoning(ctx, "\n\n")
+			}
+		case "response.reasoning_summary_text.delta":
+			summarized = true
+			emitReasoning(ctx, event.Delta)
+		case "response.completed":
+			completed = event.Response
+		case "response.failed", "response.incomplete":
+			if event.Response != nil && event.Response.Error != nil {
+				return &APIError{Code: event.Response.Error.Code, Message: event.Response.Error.Message}
+			}
+			return &APIError{Message: event.Type}
+		case "error":
+			return &APIError{Message: event.Message}
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return "", "", fmt.Errorf("request canceled: %w", ctx.Err())
+		}
+		logger.Error("Failed to read Responses API stream: %v", err)
+		return "", "", err
+	}
+
+	if completed != nil && completed.Usage != nil {
+		c.recordUsage(ctx, model, completed.Usage.usage())
+	}
+	tools := c.nativeToolSession(ctx)
+	if tools != nil && completed != nil {
+		tools.Calls = responseToolCalls(*completed)
+	}
+
+	text := content.String()
+	if text == "" && completed != nil {
+		text = completed.OutputText
+		if text == "" {
+			text = responseOutputText(*completed)
+		}
+	}
+	if text == "" && (tools == nil || len(tools.Calls) == 0) {
+		logger.Error("No content in streamed Responses API response (model: %s)", model)
+		return "", "", fmt.Errorf("no response content returned (model: %s)", model)
+	}
+
+	logger.Debug("Received streamed Responses API response (%d characters): %s", len(text), text)
+	var responseID string
+	if completed != nil {
+		responseID = completed.ID
+	}
+	return text, responseID, nil
 }
 
 func debugChatMessages(chatMessages []ChatMessage, response string) {
+	debugChatExchange(chatMessages, "", response)
+}
+
+// debugModelExchange is debugChatMessages for one of several models answering at once,
+// the model is part of the file name so the files written in the same second don't overwrite each other
+func debugModelExchange(model string, chatMessages []ChatMessage, response string) {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == ':' || r == ' ' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, model)
+	writeDebugExchange("-"+name, chatMessages, "", response)
+}
+
+// debugChatExchange writes the sent messages, the reasoning summary if any and the response to a debug file
+func debugChatExchange(chatMessages []ChatMessage, reasoning string, response string) {
+	writeDebugExchange("", chatMessages, reasoning, response)
+}
+
+// writeDebugExchange writes a debug file named after the current time and the suffix
+func writeDebugExchange(suffix string, chatMessages []ChatMessage, reasoning string, response string) {
 
 	timestamp := time.Now().Format("20060102-150405")
 	configDir, _ := config.GetConfigDir()
@@ -492,7 +1014,7 @@ func debugChatMessages(chatMessages []ChatMessage, response string) {
 		_ = os.Mkdir(debugDir, 0755)
 	}
 
-	debugFileName := fmt.Sprintf("%s/debug-%s.txt", debugDir, timestamp)
+	debugFileName := fmt.Sprintf("%s/debug-%s%s.txt", debugDir, timestamp, suffix)
 
 	file, err := os.Create(debugFileName)
 	if err != nil {
@@ -517,6 +1039,11 @@ func debugChatMessages(chatMessages []ChatMessage, response string) {
 		_, _ = fmt.Fprintf(file, "Content:\n%s\n\n", msg.Content)
 	}
 
+	if reasoning != "" {
+		_, _ = file.WriteString("==================    RECEIVED REASONING ==================\n\n")
+		_, _ = file.WriteString(reasoning + "\n\n")
+	}
+
 	_, _ = file.WriteString("==================    RECEIVED RESPONSE ==================\n\n")
 	_, _ = file.WriteString(response)
 	_, _ = file.WriteString("\n\n==================    END DEBUG ==================\n")
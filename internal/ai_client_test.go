@@ -2,8 +2,11 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/alvinunreal/tmuxai/config"
@@ -134,13 +137,13 @@ func TestDetermineAPIType(t *testing.T) {
 	client := NewAiClient(cfg)
 
 	// Test OpenAI API type (highest priority) - should work with any model when OpenAI key is present
-	apiType := client.determineAPIType("gpt-5-codex")
+	apiType := client.determineAPIType(context.Background(), "gpt-5-codex")
 	if apiType != "responses" {
 		t.Errorf("expected 'responses', got %s", apiType)
 	}
 
 	// Test that OpenAI is selected regardless of model when API key is present
-	apiType = client.determineAPIType("any-model")
+	apiType = client.determineAPIType(context.Background(), "any-model")
 	if apiType != "responses" {
 		t.Errorf("expected 'responses' for any model when OpenAI key is present, got %s", apiType)
 	}
@@ -149,7 +152,7 @@ func TestDetermineAPIType(t *testing.T) {
 	cfg.OpenAI.APIKey = ""
 	cfg.AzureOpenAI.APIKey = "azure-key"
 	client = NewAiClient(cfg)
-	apiType = client.determineAPIType("any-model")
+	apiType = client.determineAPIType(context.Background(), "any-model")
 	if apiType != "azure" {
 		t.Errorf("expected 'azure', got %s", apiType)
 	}
@@ -157,7 +160,7 @@ func TestDetermineAPIType(t *testing.T) {
 	// Test OpenRouter API type (default)
 	cfg.AzureOpenAI.APIKey = ""
 	client = NewAiClient(cfg)
-	apiType = client.determineAPIType("openrouter-model")
+	apiType = client.determineAPIType(context.Background(), "openrouter-model")
 	if apiType != "openrouter" {
 		t.Errorf("expected 'openrouter', got %s", apiType)
 	}
@@ -244,3 +247,433 @@ func TestSessionOverrides(t *testing.T) {
 	manager.Config.OpenAI.APIKey = originalOpenAIKey
 	manager.Config.AzureOpenAI.APIKey = originalAzureKey
 }
+
+func TestChatCompletionStreaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"stream":true`) {
+			t.Errorf("expected stream flag in request body: %s", body)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hello\"}}]}\n\n"))
+		_, _ = w.Write([]byte(": keep-alive\n\n"))
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\" world\"}}]}\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		OpenRouter: config.OpenRouterConfig{APIKey: "test-key", BaseURL: server.URL},
+	}
+
+	var deltas []string
+	ctx := WithStreamHandler(context.Background(), func(delta string) {
+		deltas = append(deltas, delta)
+	})
+
+	client := NewAiClient(cfg)
+	resp, err := client.ChatCompletion(ctx, []Message{{Role: "user", Content: "hi"}}, "model")
+	if err != nil {
+		t.Fatalf("ChatCompletion error: %v", err)
+	}
+	if resp != "Hello world" {
+		t.Errorf("unexpected response: %q", resp)
+	}
+	if len(deltas) != 2 || deltas[0] != "Hello" || deltas[1] != " world" {
+		t.Errorf("unexpected deltas: %q", deltas)
+	}
+}
+
+func TestChatCompletionStreamingIgnoredByServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		OpenRouter: config.OpenRouterConfig{APIKey: "test-key", BaseURL: server.URL},
+	}
+
+	ctx := WithStreamHandler(context.Background(), func(string) {})
+	client := NewAiClient(cfg)
+	resp, err := client.ChatCompletion(ctx, []Message{{Role: "user", Content: "hi"}}, "model")
+	if err != nil {
+		t.Fatalf("ChatCompletion error: %v", err)
+	}
+	if resp != "ok" {
+		t.Errorf("unexpected response: %q", resp)
+	}
+}
+
+func TestOpenAIResponsesStreaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"ok \"}\n\n"))
+		_, _ = w.Write([]byte("event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"streamed\"}\n\n"))
+		_, _ = w.Write([]byte("event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp-1\",\"output_text\":\"ok streamed\"}}\n\n"))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		OpenAI: config.OpenAIConfig{APIKey: "test-key", BaseURL: server.URL},
+	}
+
+	var streamed strings.Builder
+	ctx := WithStreamHandler(context.Background(), func(delta string) {
+		streamed.WriteString(delta)
+	})
+
+	client := NewAiClient(cfg)
+	resp, err := client.Response(ctx, []Message{{Role: "user", Content: "hi"}}, "gpt-5")
+	if err != nil {
+		t.Fatalf("Response error: %v", err)
+	}
+	if resp != "ok streamed" || streamed.String() != "ok streamed" {
+		t.Errorf("unexpected response: %q, streamed: %q", resp, streamed.String())
+	}
+}
+
+func TestChatCompletionStreamingCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"partial\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := &config.Config{
+		OpenRouter: config.OpenRouterConfig{APIKey: "test-key", BaseURL: server.URL},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = WithStreamHandler(ctx, func(string) { cancel() })
+
+	client := NewAiClient(cfg)
+	_, err := client.ChatCompletion(ctx, []Message{{Role: "user", Content: "hi"}}, "model")
+	if err == nil || !strings.Contains(err.Error(), "request canceled") {
+		t.Errorf("expected canceled error, got %v", err)
+	}
+}
+
+func TestAnthropicMessagesEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" {
+			t.Errorf("missing x-api-key header")
+		}
+		if r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("missing anthropic-version header")
+		}
+
+		var req AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.System != "You are a helpful assistant\n\n=== Knowledge Base ===" {
+			t.Errorf("unexpected system prompt: %q", req.System)
+		}
+		if len(req.Messages) != 1 || req.Messages[0].Role != "user" || req.Messages[0].Content != "hi" {
+			t.Errorf("unexpected messages: %+v", req.Messages)
+		}
+		if req.MaxTokens == 0 {
+			t.Errorf("max_tokens must be set")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"ok from "},{"type":"text","text":"anthropic"}],"stop_reason":"end_turn"}`))
+	}))
+	defer server.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "anthropic", Model: "claude-sonnet-4-5", APIKey: "test-key", BaseURL: server.URL})
+
+	chatMessages := []ChatMessage{
+		{Content: "You are a helpful assistant", FromUser: false},
+		{Content: "=== Knowledge Base ===", FromUser: false},
+		{Content: "hi", FromUser: true},
+	}
+	resp, err := client.GetResponseFromChatMessages(context.Background(), chatMessages, "claude-sonnet-4-5")
+	if err != nil {
+		t.Fatalf("GetResponseFromChatMessages error: %v", err)
+	}
+	if resp != "ok from anthropic" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+}
+
+func TestAnthropicMessagesStreaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\"}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n"))
+		_, _ = w.Write([]byte("event: ping\ndata: {\"type\":\"ping\"}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\" there\"}}\n\n"))
+		_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer server.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "anthropic", Model: "claude-sonnet-4-5", APIKey: "test-key", BaseURL: server.URL})
+
+	var streamed strings.Builder
+	ctx := WithStreamHandler(context.Background(), func(delta string) {
+		streamed.WriteString(delta)
+	})
+
+	resp, err := client.AnthropicMessages(ctx, []Message{{Role: "user", Content: "hi"}}, "claude-sonnet-4-5")
+	if err != nil {
+		t.Fatalf("AnthropicMessages error: %v", err)
+	}
+	if resp != "Hello there" || streamed.String() != "Hello there" {
+		t.Errorf("unexpected response: %q, streamed: %q", resp, streamed.String())
+	}
+}
+
+func TestAnthropicMessagesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "anthropic", Model: "claude-sonnet-4-5", APIKey: "test-key", BaseURL: server.URL})
+
+	_, err := client.AnthropicMessages(context.Background(), []Message{{Role: "user", Content: "hi"}}, "claude-sonnet-4-5")
+	if err == nil || !strings.Contains(err.Error(), "invalid x-api-key") {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+}
+
+func TestOllamaChatEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req["stream"] != false {
+			t.Errorf("expected stream to be explicitly disabled, got %v", req["stream"])
+		}
+		if req["keep_alive"] != "10m" {
+			t.Errorf("unexpected keep_alive: %v", req["keep_alive"])
+		}
+		options, _ := req["options"].(map[string]interface{})
+		if options["num_ctx"] != float64(32768) {
+			t.Errorf("unexpected options: %v", req["options"])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"model":"llama3","message":{"role":"assistant","content":"ok from ollama"},"done":true}`))
+	}))
+	defer server.Close()
+
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "local",
+			Models: map[string]config.ModelConfig{
+				"local": {Provider: "ollama", Model: "llama3", BaseURL: server.URL + "/v1", KeepAlive: "10m", NumCtx: 32768},
+			},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+	client := NewAiClient(manager.Config)
+	client.SetConfigManager(manager)
+
+	resp, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "llama3")
+	if err != nil {
+		t.Fatalf("GetResponseFromChatMessages error: %v", err)
+	}
+	if resp != "ok from ollama" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+}
+
+func TestOllamaChatStreaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = w.Write([]byte(`{"message":{"role":"assistant","content":"Hello"},"done":false}` + "\n"))
+		_, _ = w.Write([]byte(`{"message":{"role":"assistant","content":" local"},"done":false}` + "\n"))
+		_, _ = w.Write([]byte(`{"message":{"role":"assistant","content":""},"done":true,"eval_count":2}` + "\n"))
+	}))
+	defer server.Close()
+
+	manager := &Manager{
+		Config: &config.Config{
+			Models: map[string]config.ModelConfig{
+				"local": {Provider: "ollama", Model: "llama3", BaseURL: server.URL},
+			},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+	client := NewAiClient(manager.Config)
+	client.SetConfigManager(manager)
+
+	var streamed strings.Builder
+	ctx := WithStreamHandler(context.Background(), func(delta string) {
+		streamed.WriteString(delta)
+	})
+
+	resp, err := client.OllamaChat(ctx, []Message{{Role: "user", Content: "hi"}}, "llama3")
+	if err != nil {
+		t.Fatalf("OllamaChat error: %v", err)
+	}
+	if resp != "Hello local" || streamed.String() != "Hello local" {
+		t.Errorf("unexpected response: %q, streamed: %q", resp, streamed.String())
+	}
+}
+
+func TestSamplingParametersForwarded(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		bodies = append(bodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/responses" {
+			_, _ = w.Write([]byte(`{"output_text":"ok"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	temperature := 0.0
+	topP := 0.9
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "chat",
+			Models: map[string]config.ModelConfig{
+				"chat": {Provider: "openrouter", Model: "m", BaseURL: server.URL, Temperature: &temperature, TopP: &topP,
+					MaxTokens: 512, Stop: []string{"END"}, ReasoningEffort: "low"},
+				"responses": {Provider: "openai", Model: "m", BaseURL: server.URL, Temperature: &temperature,
+					MaxTokens: 512, ReasoningEffort: "high", Stateless: true},
+			},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+	client := NewAiClient(manager.Config)
+	client.SetConfigManager(manager)
+	msg := []ChatMessage{{Content: "hi", FromUser: true}}
+
+	if _, err := client.GetResponseFromChatMessages(context.Background(), msg, "m"); err != nil {
+		t.Fatalf("chat completion error: %v", err)
+	}
+	manager.SetModelsDefault("responses")
+	if _, err := client.GetResponseFromChatMessages(context.Background(), msg, "m"); err != nil {
+		t.Fatalf("responses error: %v", err)
+	}
+
+	chat := bodies[0]
+	if chat["temperature"] != 0.0 || chat["top_p"] != 0.9 || chat["max_tokens"] != float64(512) || chat["reasoning_effort"] != "low" {
+		t.Errorf("unexpected chat completion parameters: %v", chat)
+	}
+	if stop, _ := chat["stop"].([]interface{}); len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("unexpected stop sequences: %v", chat["stop"])
+	}
+
+	responses := bodies[1]
+	reasoning, _ := responses["reasoning"].(map[string]interface{})
+	if responses["temperature"] != 0.0 || responses["max_output_tokens"] != float64(512) || reasoning["effort"] != "high" {
+		t.Errorf("unexpected Responses API parameters: %v", responses)
+	}
+	if _, exists := responses["top_p"]; exists {
+		t.Errorf("unset top_p should not be sent: %v", responses)
+	}
+}
+
+func TestReasoningSummaries(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		bodies = append(bodies, body)
+		stream := body["stream"] == true
+		switch {
+		case r.URL.Path == "/responses" && stream:
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: {\"type\":\"response.reasoning_summary_part.added\"}\n\n"))
+			_, _ = w.Write([]byte("data: {\"type\":\"response.reasoning_summary_text.delta\",\"delta\":\"First part\"}\n\n"))
+			_, _ = w.Write([]byte("data: {\"type\":\"response.reasoning_summary_part.added\"}\n\n"))
+			_, _ = w.Write([]byte("data: {\"type\":\"response.reasoning_summary_text.delta\",\"delta\":\"second part\"}\n\n"))
+			_, _ = w.Write([]byte("data: {\"type\":\"response.output_text.delta\",\"delta\":\"ok\"}\n\n"))
+		case r.URL.Path == "/responses":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"output":[{"type":"reasoning","summary":[{"type":"summary_text","text":"Thought about it"}]}],"output_text":"ok"}`))
+		case stream:
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"reasoning\":\"Streamed \"}}]}\n\n"))
+			_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"reasoning\":\"thought\"}}]}\n\n"))
+			_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"}}]}\n\n"))
+			_, _ = w.Write([]byte("data: [DONE]\n\n"))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok","reasoning":"Thought about it"}}]}`))
+		}
+	}))
+	defer server.Close()
+
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "router",
+			Models: map[string]config.ModelConfig{
+				"router": {Provider: "openrouter", Model: "m", APIKey: "key", BaseURL: server.URL, ReasoningSummary: "auto"},
+				"openai": {Provider: "openai", Model: "m", APIKey: "key", BaseURL: server.URL, ReasoningSummary: "detailed", Stateless: true},
+			},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+	client := NewAiClient(manager.Config)
+	client.SetConfigManager(manager)
+
+	ask := func(stream bool) (string, string) {
+		var reasoning strings.Builder
+		ctx := WithReasoningHandler(context.Background(), func(delta string) { reasoning.WriteString(delta) })
+		if stream {
+			ctx = WithStreamHandler(ctx, func(string) {})
+		}
+		resp, err := client.GetResponseFromChatMessages(ctx, []ChatMessage{{Content: "hi", FromUser: true}}, "m")
+		if err != nil {
+			t.Fatalf("GetResponseFromChatMessages error: %v", err)
+		}
+		return resp, reasoning.String()
+	}
+
+	for _, tt := range []struct {
+		model     string
+		stream    bool
+		reasoning string
+	}{
+		{"router", false, "Thought about it"},
+		{"router", true, "Streamed thought"},
+		{"openai", false, "Thought about it"},
+		{"openai", true, "First part\n\nsecond part"},
+	} {
+		manager.SetModelsDefault(tt.model)
+		resp, reasoning := ask(tt.stream)
+		if resp != "ok" || reasoning != tt.reasoning {
+			t.Errorf("%s (stream %v): unexpected response %q with reasoning %q", tt.model, tt.stream, resp, reasoning)
+		}
+	}
+
+	if enabled, _ := bodies[0]["reasoning"].(map[string]interface{}); enabled["enabled"] != true {
+		t.Errorf("reasoning not requested from OpenRouter: %v", bodies[0])
+	}
+	if summary, _ := bodies[2]["reasoning"].(map[string]interface{}); summary["summary"] != "detailed" {
+		t.Errorf("reasoning summary not requested from the Responses API: %v", bodies[2])
+	}
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Kinds of provider failures, a provider error matches one of them with errors.Is
+var (
+	ErrAuth          = errors.New("authentication failed")
+	ErrRateLimit     = errors.New("rate limited")
+	ErrContextLength = errors.New("context length exceeded")
+	ErrContentFilter = errors.New("blocked by content filter")
+	ErrServer        = errors.New("provider server error")
+)
+
+// contextLengthMarkers are found in the errors providers return for prompts over the context window
+var contextLengthMarkers = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context window",
+	"prompt is too long",
+	"input is too long",
+	"too many tokens",
+	"request too large",
+	"exceeds the maximum number of tokens",
+}
+
+// rateLimitMarkers are found in rate limit errors reported without a 429 status, such as stream errors.
+// They are checked first: tokens per minute limits also speak of requests that are too large.
+var rateLimitMarkers = []string{
+	"rate_limit_exceeded",
+	"rate limit",
+	"tokens per min",
+}
+
+// contentFilterMarkers are found in the errors providers return for blocked prompts or answers
+var contentFilterMarkers = []string{
+	"content_filter",
+	"content_policy_violation",
+	"content management policy",
+	"responsibleaipolicyviolation",
+	"safety system",
+}
+
+// APIStatusError is returned when a provider answers with a non-200 status
+type APIStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIStatusError) Error() string {
+	return fmt.Sprintf("API returned error: %s", e.Body)
+}
+
+// Unwrap returns the kind of failure, if it is a known one
+func (e *APIStatusError) Unwrap() error {
+	return classifyAPIError(e.StatusCode, e.Body)
+}
+
+// APIError is an error reported in the body of a successful response or in a stream
+type APIError struct {
+	Code    string // machine readable code, if the provider sends one
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return "API error: " + e.Message
+}
+
+// Unwrap returns the kind of failure, if it is a known one
+func (e *APIError) Unwrap() error {
+	return classifyAPIError(0, e.Code+" "+e.Message)
+}
+
+// ModelError tells which model configuration a request failed with
+type ModelError struct {
+	Model string
+	Err   error
+}
+
+func (e *ModelError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ModelError) Unwrap() error {
+	return e.Err
+}
+
+// classifyAPIError returns the kind of a provider failure from its status code and message, nil if unknown
+func classifyAPIError(statusCode int, message string) error {
+	lower := strings.ToLower(message)
+	if statusCode == http.StatusTooManyRequests {
+		return ErrRateLimit
+	}
+	for _, marker := range rateLimitMarkers {
+		if strings.Contains(lower, marker) {
+			return ErrRateLimit
+		}
+	}
+	for _, marker := range contextLengthMarkers {
+		if strings.Contains(lower, marker) {
+			return ErrContextLength
+		}
+	}
+	if statusCode == http.StatusRequestEntityTooLarge {
+		return ErrContextLength
+	}
+	for _, marker := range contentFilterMarkers {
+		if strings.Contains(lower, marker) {
+			return ErrContentFilter
+		}
+	}
+
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrAuth
+	case statusCode >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+// contentFilterError is returned when a provider withholds the answer because of its content filter
+func contentFilterError(model string) error {
+	return fmt.Errorf("%w (model: %s)", ErrContentFilter, model)
+}
+
+// providerErrorHint explains how to resolve a provider failure, empty if there is nothing to add
+func (m *Manager) providerErrorHint(err error) string {
+	switch {
+	case errors.Is(err, ErrAuth):
+		return fmt.Sprintf("The provider rejected the API key, check %s in your config", m.apiKeySetting(err))
+	case errors.Is(err, ErrRateLimit):
+		return "The provider is rate limiting requests, wait a moment or switch models with /model"
+	case errors.Is(err, ErrContextLength):
+		return "The conversation is too long for the model, use /squash or /clear"
+	case errors.Is(err, ErrContentFilter):
+		return "The provider's content filter blocked the request or its answer, try rephrasing it"
+	case errors.Is(err, ErrServer):
+		return "The provider is having problems, try again later or switch models with /model"
+	}
+	return ""
+}
+
+// apiKeySetting returns the config key holding the API key of the model a request failed with
+func (m *Manager) apiKeySetting(err error) string {
+	name := m.GetModelsDefault()
+	var modelErr *ModelError
+	if errors.As(err, &modelErr) {
+		name = modelErr.Model
+	}
+
+	if modelConfig, exists := m.Config.Models[name]; exists {
+		switch {
+		case modelConfig.APIKey == "" && modelConfig.APIKeyCommand != "":
+			return fmt.Sprintf("models.%s.api_key_command", name)
+		case modelConfig.APIKey == "" && modelConfig.APIKeyFile != "":
+			return fmt.Sprintf("models.%s.api_key_file", name)
+		}
+		return fmt.Sprintf("models.%s.api_key", name)
+	}
+
+	// Legacy configuration
+	switch m.getLegacyModelConfig().Provider {
+	case "openai":
+		return "openai.api_key"
+	case "azure":
+		return "azure_openai.api_key"
+	}
+	return "openrouter.api_key"
+}
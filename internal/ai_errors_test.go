@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyAPIError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"unauthorized", &APIStatusError{StatusCode: 401, Body: `{"error":{"message":"Invalid API key"}}`}, ErrAuth},
+		{"forbidden", &APIStatusError{StatusCode: 403, Body: "forbidden"}, ErrAuth},
+		{"rate limit", &APIStatusError{StatusCode: 429, Body: "slow down"}, ErrRateLimit},
+		{"openai tokens per minute", &APIStatusError{StatusCode: 429, Body: `{"error":{"message":"Request too large for gpt-4o in organization org-abc on tokens per min (TPM): Limit 30000, Requested 41250. The input or output tokens must be reduced in order to run successfully. Visit https://platform.openai.com/account/rate-limits to learn more.","type":"tokens","param":null,"code":"rate_limit_exceeded"}}`}, ErrRateLimit},
+		{"stream rate limit", &APIError{Code: "rate_limit_exceeded", Message: "Rate limit reached for gpt-4o on tokens per min (TPM): Limit 30000, Used 29000, Requested 2000."}, ErrRateLimit},
+		{"openai context length", &APIStatusError{StatusCode: 400, Body: `{"error":{"code":"context_length_exceeded"}}`}, ErrContextLength},
+		{"anthropic context length", &APIStatusError{StatusCode: 400, Body: `{"type":"error","error":{"message":"prompt is too long: 210000 tokens > 200000 maximum"}}`}, ErrContextLength},
+		{"payload too large", &APIStatusError{StatusCode: 413, Body: ""}, ErrContextLength},
+		{"azure content filter", &APIStatusError{StatusCode: 400, Body: `{"error":{"code":"content_filter"}}`}, ErrContentFilter},
+		{"server error", &APIStatusError{StatusCode: 503, Body: "overloaded"}, ErrServer},
+		{"bad request", &APIStatusError{StatusCode: 400, Body: "invalid model"}, nil},
+		{"responses error code", &APIError{Code: "context_length_exceeded", Message: "Your input exceeds the limit"}, ErrContextLength},
+		{"wrapped", &ModelError{Model: "main", Err: fmt.Errorf("failed to read response stream: %w", &APIError{Message: "prompt is too long"})}, ErrContextLength},
+	}
+
+	kinds := []error{ErrAuth, ErrRateLimit, ErrContextLength, ErrContentFilter, ErrServer}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, kind := range kinds {
+				assert.Equal(t, kind == tt.kind, errors.Is(tt.err, kind), "errors.Is(%v)", kind)
+			}
+		})
+	}
+}
+
+func TestContentFilterFinishReason(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":""},"finish_reason":"content_filter"}]}`))
+	}))
+	defer server.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: server.URL})
+	_, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "test-model")
+	assert.ErrorIs(t, err, ErrContentFilter)
+
+	var modelErr *ModelError
+	require.ErrorAs(t, err, &modelErr)
+	assert.Equal(t, "main", modelErr.Model)
+}
+
+func TestAPIKeySetting(t *testing.T) {
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "main",
+			Models: map[string]config.ModelConfig{
+				"main":    {Provider: "openrouter", APIKey: "key"},
+				"gateway": {Provider: "openrouter", APIKeyCommand: "pass show gateway"},
+			},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+
+	assert.Equal(t, "models.main.api_key", manager.apiKeySetting(&APIStatusError{StatusCode: 401}))
+	assert.Equal(t, "models.gateway.api_key_command", manager.apiKeySetting(&ModelError{Model: "gateway", Err: &APIStatusError{StatusCode: 401}}))
+	assert.Contains(t, manager.providerErrorHint(&ModelError{Model: "gateway", Err: &APIStatusError{StatusCode: 401}}), "models.gateway.api_key_command")
+
+	legacy := &Manager{
+		Config:           &config.Config{OpenAI: config.OpenAIConfig{APIKey: "sk"}},
+		SessionOverrides: make(map[string]interface{}),
+	}
+	assert.Equal(t, "openai.api_key", legacy.apiKeySetting(&APIStatusError{StatusCode: 401}))
+}
+
+func TestProcessUserMessage_ContextOverflowRecovery(t *testing.T) {
+	overflow := &ModelError{Model: "main", Err: &APIStatusError{StatusCode: 400, Body: `{"error":{"code":"context_length_exceeded"}}`}}
+
+	mockAiClient := &MockAiClient{}
+	mockAiClient.On("GetResponseFromChatMessages", mock.Anything, mock.Anything, mock.Anything).Return("", overflow).Once()
+	mockAiClient.On("GetResponseFromChatMessages", mock.Anything, mock.Anything, mock.Anything).Return("summary of the session", nil).Once()
+	mockAiClient.On("GetResponseFromChatMessages", mock.Anything, mock.Anything, mock.Anything).Return("<RequestAccomplished>1</RequestAccomplished>", nil).Once()
+
+	manager := &Manager{
+		Config:           &config.Config{MaxContextSize: 1000000, OpenRouter: config.OpenRouterConfig{APIKey: "key"}},
+		SessionOverrides: make(map[string]interface{}),
+		Status:           "running",
+		AiClient:         mockAiClient,
+		ExecPane:         &system.TmuxPaneDetails{},
+		Messages: []ChatMessage{
+			{Content: "first question", FromUser: true},
+			{Content: "first answer"},
+			{Content: "second question", FromUser: true},
+			{Content: "second answer"},
+		},
+	}
+	manager.getTmuxPanesInXml = func(config *config.Config) string {
+		return "<tmux>mock pane content</tmux>"
+	}
+
+	accomplished := manager.ProcessUserMessage(context.Background(), "third question")
+
+	assert.True(t, accomplished)
+	mockAiClient.AssertNumberOfCalls(t, "GetResponseFromChatMessages", 3)
+	require.NotEmpty(t, manager.Messages)
+	assert.Contains(t, manager.Messages[0].Content, "summary of the session")
+}
+
+func TestProcessUserMessage_ContextOverflowRetriedOnce(t *testing.T) {
+	overflow := &APIStatusError{StatusCode: 400, Body: "maximum context length exceeded"}
+
+	mockAiClient := &MockAiClient{}
+	mockAiClient.On("GetResponseFromChatMessages", mock.Anything, mock.Anything, mock.Anything).Return("", overflow)
+
+	manager := &Manager{
+		Config:           &config.Config{MaxContextSize: 1000000, OpenRouter: config.OpenRouterConfig{APIKey: "key"}},
+		SessionOverrides: make(map[string]interface{}),
+		Status:           "running",
+		AiClient:         mockAiClient,
+		ExecPane:         &system.TmuxPaneDetails{},
+	}
+	manager.getTmuxPanesInXml = func(config *config.Config) string {
+		return "<tmux>mock pane content</tmux>"
+	}
+
+	assert.False(t, manager.ProcessUserMessage(context.Background(), "question"))
+	mockAiClient.AssertNumberOfCalls(t, "GetResponseFromChatMessages", 2)
+}
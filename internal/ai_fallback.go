@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+type modelConfigKey struct{}
+
+// withModelConfig returns a context that makes the providers use the given model configuration
+// instead of the current one, which is how fallback models are addressed
+func withModelConfig(ctx context.Context, modelConfig config.ModelConfig) context.Context {
+	return context.WithValue(ctx, modelConfigKey{}, modelConfig)
+}
+
+// currentModelConfig returns the model configuration a request should use
+func (c *AiClient) currentModelConfig(ctx context.Context) (config.ModelConfig, bool) {
+	if modelConfig, ok := ctx.Value(modelConfigKey{}).(config.ModelConfig); ok {
+		return modelConfig, true
+	}
+	if c.configMgr != nil {
+		return c.configMgr.GetCurrentModelConfig()
+	}
+	return config.ModelConfig{}, false
+}
+
+// shouldFallback reports whether an error is a hard failure of the provider that another model may not have:
+// auth errors, unknown models, rate limits and server errors left after retrying, timeouts and network errors
+func shouldFallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var statusErr *APIStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return statusErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// getResponseWithFallback sends the messages to the current model, or the model of the role the request
+// is for, and when it fails hard to each model of the fallback chain in turn until one of them answers
+func (c *AiClient) getResponseWithFallback(ctx context.Context, messages []Message, model string) (string, error) {
+	if pinned, ok := ctx.Value(pinnedModelKey{}).(pinnedModel); ok {
+		return c.getPinnedResponse(ctx, messages, pinned)
+	}
+
+	role, _ := ctx.Value(modelRoleKey{}).(string)
+	background := role == RoleSummarize || role == RoleReflect
+
+	answeredBy := model
+	var fallbacks []string
+	if c.configMgr != nil {
+		current := c.configMgr.GetModelsDefault()
+		if routed := c.configMgr.GetRoleModel(role); routed != current || background {
+			if modelConfig, exists := c.configMgr.GetModelConfig(routed); exists {
+				// Background work must not continue, or replace, the stored response of the conversation
+				modelConfig.Stateless = modelConfig.Stateless || background
+				ctx = withModelConfig(ctx, modelConfig)
+				model = modelConfig.Model
+				current = routed
+			}
+		}
+		if current != "" {
+			answeredBy = current
+		}
+		for _, name := range c.configMgr.GetFallbackModels() {
+			if name != answeredBy {
+				fallbacks = append(fallbacks, name)
+			}
+		}
+	}
+
+	// Once part of an answer has been shown, asking another model would print a second one
+	streamed := false
+	if onDelta := streamHandlerFromContext(ctx); onDelta != nil {
+		ctx = WithStreamHandler(ctx, func(delta string) {
+			streamed = true
+			onDelta(delta)
+		})
+	}
+
+	var usage Usage
+	response, err := c.sendMessages(withUsageCollector(ctx, &usage), messages, model)
+	for _, name := range fallbacks {
+		if err == nil || streamed || !shouldFallback(ctx, err) {
+			break
+		}
+		modelConfig, _ := c.configMgr.GetModelConfig(name)
+		modelConfig.Stateless = modelConfig.Stateless || background
+		logger.Warn("Model %s failed, falling back to %s: %v", answeredBy, name, err)
+		c.configMgr.Println(fmt.Sprintf("Model %s failed, falling back to %s...", answeredBy, name))
+
+		answeredBy = name
+		usage = Usage{}
+		response, err = c.sendMessages(withUsageCollector(withModelConfig(ctx, modelConfig), &usage), messages, modelConfig.Model)
+	}
+	if err != nil {
+		return "", &ModelError{Model: answeredBy, Err: err}
+	}
+
+	logger.Info("Response received from model: %s", answeredBy)
+	if c.configMgr != nil {
+		if usage.Requests > 0 {
+			c.configMgr.recordUsage(answeredBy, usage)
+		}
+		// Only answers in the conversation tell which model is answering and how large the context is
+		if !background {
+			c.configMgr.AnsweringModel = answeredBy
+			if usage.Requests > 0 {
+				c.configMgr.usageTracker().SetLast(usage)
+			}
+		}
+	}
+	return response, nil
+}
+
+type modelRoleKey struct{}
+
+// withModelRole returns a context that routes a request to the model of a role, see model_roles
+func withModelRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, modelRoleKey{}, role)
+}
+
+type pinnedModelKey struct{}
+
+// pinnedModel is a model a request is sent to on its own, outside of the conversation
+type pinnedModel struct {
+	name  string
+	usage *Usage
+}
+
+// withPinnedModel returns a context that sends a request to the named model only, with no fallbacks.
+// The usage of the request is collected into usage instead of the session totals, and neither the
+// answering model nor the response chain of the conversation are touched.
+func withPinnedModel(ctx context.Context, name string, usage *Usage) context.Context {
+	return context.WithValue(ctx, pinnedModelKey{}, pinnedModel{name: name, usage: usage})
+}
+
+// getPinnedResponse sends the messages to a pinned model
+func (c *AiClient) getPinnedResponse(ctx context.Context, messages []Message, pinned pinnedModel) (string, error) {
+	if c.configMgr == nil {
+		return "", fmt.Errorf("model %s is not configured", pinned.name)
+	}
+	modelConfig, exists := c.configMgr.GetModelConfig(pinned.name)
+	if !exists {
+		return "", fmt.Errorf("model %s is not configured", pinned.name)
+	}
+	// A side request must not continue, or replace, the stored response of the conversation
+	modelConfig.Stateless = true
+
+	ctx = withModelConfig(ctx, modelConfig)
+	if pinned.usage != nil {
+		ctx = withUsageCollector(ctx, pinned.usage)
+	}
+	response, err := c.sendMessages(ctx, messages, modelConfig.Model)
+	if err != nil {
+		return "", &ModelError{Model: pinned.name, Err: err}
+	}
+	logger.Info("Response received from model: %s", pinned.name)
+	return response, nil
+}
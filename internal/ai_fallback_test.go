@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func TestFallbackToNextModel(t *testing.T) {
+	withRetryBaseDelay(t, time.Millisecond)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+	}))
+	defer unauthorized.Close()
+
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"message":{"role":"assistant","content":"ok from fallback"},"done":true}`))
+	}))
+	defer local.Close()
+
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "primary",
+			Models: map[string]config.ModelConfig{
+				"primary": {Provider: "openrouter", Model: "remote", APIKey: "key", BaseURL: primary.URL, MaxAttempts: 2},
+				"backup":  {Provider: "openrouter", Model: "other", APIKey: "bad-key", BaseURL: unauthorized.URL},
+				"local":   {Provider: "ollama", Model: "llama3", BaseURL: local.URL},
+			},
+			FallbackModels: []string{"primary", "missing", "backup", "local"},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+	client := NewAiClient(manager.Config)
+	client.SetConfigManager(manager)
+
+	resp, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "remote")
+	if err != nil {
+		t.Fatalf("GetResponseFromChatMessages error: %v", err)
+	}
+	if resp != "ok from fallback" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	if manager.AnsweringModel != "local" {
+		t.Errorf("expected answering model to be local, got %q", manager.AnsweringModel)
+	}
+}
+
+func TestNoFallbackOnBadRequest(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer primary.Close()
+
+	var fallbackCalls int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fallbackCalls, 1)
+	}))
+	defer backup.Close()
+
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "primary",
+			Models: map[string]config.ModelConfig{
+				"primary": {Provider: "openrouter", Model: "remote", APIKey: "key", BaseURL: primary.URL},
+				"backup":  {Provider: "ollama", Model: "llama3", BaseURL: backup.URL},
+			},
+			FallbackModels: []string{"backup"},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+	client := NewAiClient(manager.Config)
+	client.SetConfigManager(manager)
+
+	if _, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "remote"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if fallbackCalls != 0 {
+		t.Errorf("expected no fallback on a bad request, got %d calls", fallbackCalls)
+	}
+}
+
+func TestGetFallbackModels(t *testing.T) {
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "a",
+			Models: map[string]config.ModelConfig{
+				"a": {Provider: "openrouter"},
+				"b": {Provider: "openrouter"},
+			},
+			FallbackModels: []string{"a", "unknown", "b"},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+
+	fallbacks := manager.GetFallbackModels()
+	if len(fallbacks) != 1 || fallbacks[0] != "b" {
+		t.Errorf("unexpected fallbacks: %v", fallbacks)
+	}
+
+	manager.SetModelsDefault("b")
+	fallbacks = manager.GetFallbackModels()
+	if len(fallbacks) != 1 || fallbacks[0] != "a" {
+		t.Errorf("unexpected fallbacks after switching: %v", fallbacks)
+	}
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+const (
+	defaultConnectTimeout  = 30 * time.Second
+	defaultResponseTimeout = 5 * time.Minute
+)
+
+// transportKey identifies the connection settings of a model, models sharing them share an http.Client
+func transportKey(modelConfig config.ModelConfig) string {
+	return strings.Join([]string{
+		modelConfig.ConnectTimeout.String(),
+		modelConfig.ResponseTimeout.String(),
+		modelConfig.Proxy,
+		modelConfig.CACert,
+		modelConfig.ClientCert,
+		modelConfig.ClientKey,
+	}, "|")
+}
+
+// httpClient returns the http.Client for the model a request goes to, building it on first use
+func (c *AiClient) httpClient(ctx context.Context) (*http.Client, error) {
+	modelConfig, _ := c.currentModelConfig(ctx)
+	return c.httpClientFor(modelConfig)
+}
+
+// httpClientFor returns the http.Client for the connection settings of a model, building it on first use
+func (c *AiClient) httpClientFor(modelConfig config.ModelConfig) (*http.Client, error) {
+	key := transportKey(modelConfig)
+
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+
+	client, err := newHTTPClient(modelConfig)
+	if err != nil {
+		return nil, err
+	}
+	if c.cassette != nil {
+		client.Transport = c.cassette.Transport(client.Transport)
+	}
+	if c.clients == nil {
+		c.clients = make(map[string]*http.Client)
+	}
+	c.clients[key] = client
+	return client, nil
+}
+
+// newHTTPClient builds an http.Client from the timeout, proxy and TLS settings of a model.
+// The response timeout only bounds the wait for the response headers, so long streams aren't cut off.
+func newHTTPClient(modelConfig config.ModelConfig) (*http.Client, error) {
+	connectTimeout := modelConfig.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+	responseTimeout := modelConfig.ResponseTimeout
+	if responseTimeout <= 0 {
+		responseTimeout = defaultResponseTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = responseTimeout
+
+	if modelConfig.Proxy != "" {
+		proxyURL, err := url.Parse(modelConfig.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", modelConfig.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := newTLSConfig(modelConfig)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	logger.Debug("Created HTTP client (connect timeout: %s, response timeout: %s, proxy: %q)", connectTimeout, responseTimeout, modelConfig.Proxy)
+	return &http.Client{Transport: transport}, nil
+}
+
+// newTLSConfig returns the TLS configuration for a private CA and client certificate, or nil if none are set
+func newTLSConfig(modelConfig config.ModelConfig) (*tls.Config, error) {
+	if modelConfig.CACert == "" && modelConfig.ClientCert == "" && modelConfig.ClientKey == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if modelConfig.CACert != "" {
+		pem, err := os.ReadFile(expandHome(modelConfig.CACert))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", modelConfig.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if modelConfig.ClientCert != "" || modelConfig.ClientKey != "" {
+		if modelConfig.ClientCert == "" || modelConfig.ClientKey == "" {
+			return nil, fmt.Errorf("client_cert and client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(expandHome(modelConfig.ClientCert), expandHome(modelConfig.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// setHeaders sets the extra headers configured for a model, replacing any default ones
+func setHeaders(req *http.Request, headers map[string]string) {
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// expandHome replaces a leading ~ in a path with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func TestHTTPClientCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: server.URL, MaxAttempts: 1})
+
+	messages := []ChatMessage{{Content: "hi", FromUser: true}}
+	if _, err := client.GetResponseFromChatMessages(context.Background(), messages, "test-model"); err == nil {
+		t.Fatal("expected a certificate error without the CA bundle")
+	}
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caPath, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modelConfig := manager.Config.Models["main"]
+	modelConfig.CACert = caPath
+	manager.Config.Models["main"] = modelConfig
+
+	response, err := client.GetResponseFromChatMessages(context.Background(), messages, "test-model")
+	if err != nil {
+		t.Fatalf("unexpected error with the CA bundle: %v", err)
+	}
+	if response != "ok" {
+		t.Errorf("expected response %q, got %q", "ok", response)
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"via proxy"}}]}`))
+	}))
+	defer proxy.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: "http://llm.internal.example/api/v1", Proxy: proxy.URL})
+
+	response, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "test-model")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if response != "via proxy" {
+		t.Errorf("expected response %q, got %q", "via proxy", response)
+	}
+	if !strings.HasPrefix(proxied, "http://llm.internal.example/api/v1/chat/completions") {
+		t.Errorf("expected the request to go through the proxy, got %q", proxied)
+	}
+}
+
+func TestHTTPClientResponseTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: server.URL, MaxAttempts: 1, ResponseTimeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	_, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "test-model")
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request took %s, the response timeout was not applied", elapsed)
+	}
+}
+
+func TestHTTPClientPerModel(t *testing.T) {
+	client := NewAiClient(&config.Config{})
+	ctx := context.Background()
+
+	first, err := client.httpClient(withModelConfig(ctx, config.ModelConfig{Model: "a"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.httpClient(withModelConfig(ctx, config.ModelConfig{Model: "b"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("expected models with the same connection settings to share a client")
+	}
+
+	third, err := client.httpClient(withModelConfig(ctx, config.ModelConfig{Model: "c", ConnectTimeout: time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == third {
+		t.Error("expected a separate client for different connection settings")
+	}
+
+	_, err = client.httpClient(withModelConfig(ctx, config.ModelConfig{ClientCert: "cert.pem"}))
+	if err == nil {
+		t.Error("expected an error for a client certificate without a key")
+	}
+	_, err = client.httpClient(withModelConfig(ctx, config.ModelConfig{CACert: filepath.Join(t.TempDir(), "missing.pem")}))
+	if err == nil {
+		t.Error("expected an error for a missing CA bundle")
+	}
+}
+
+func TestModelHeadersAndAPIKeyCommand(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "calls")
+	manager, client := newTestClient(t, config.ModelConfig{
+		Provider:      "openrouter",
+		Model:         "test-model",
+		BaseURL:       server.URL,
+		APIKeyCommand: "echo x >> " + keyFile + "; echo secret-from-command",
+		Headers: map[string]string{
+			"x-tenant-id":  "tenant-1",
+			"http-referer": "https://gateway.example",
+		},
+	})
+
+	if !manager.hasValidAIConfiguration() {
+		t.Error("expected api_key_command to count as a valid configuration")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "test-model"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if auth := got.Get("Authorization"); auth != "Bearer secret-from-command" {
+		t.Errorf("expected the key from the command, got %q", auth)
+	}
+	if tenant := got.Get("X-Tenant-Id"); tenant != "tenant-1" {
+		t.Errorf("expected the tenant header, got %q", tenant)
+	}
+	if referer := got.Get("HTTP-Referer"); referer != "https://gateway.example" {
+		t.Errorf("expected the overridden referer, got %q", referer)
+	}
+	if title := got.Get("X-Title"); title != "TmuxAI" {
+		t.Errorf("expected the default headers to be kept, got X-Title %q", title)
+	}
+
+	calls, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(calls), "x"); n != 1 {
+		t.Errorf("expected api_key_command to run once, ran %d times", n)
+	}
+}
+
+func TestResolveAPIKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("file-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := config.ResolveAPIKey(context.Background(), config.ModelConfig{APIKeyFile: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key != "file-key" {
+		t.Errorf("expected %q, got %q", "file-key", key)
+	}
+
+	key, err = config.ResolveAPIKey(context.Background(), config.ModelConfig{APIKey: "inline", APIKeyFile: path})
+	if err != nil || key != "inline" {
+		t.Errorf("expected the inline key to take precedence, got %q, %v", key, err)
+	}
+
+	if _, err := config.ResolveAPIKey(context.Background(), config.ModelConfig{APIKeyFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+	if _, err := config.ResolveAPIKey(context.Background(), config.ModelConfig{APIKeyCommand: "exit 1"}); err == nil {
+		t.Error("expected an error for a failing key command")
+	}
+}
+
+func TestResolveAPIKeyCommand(t *testing.T) {
+	// The command's stderr ends up in the error instead of the terminal
+	_, err := config.ResolveAPIKey(context.Background(), config.ModelConfig{APIKeyCommand: "echo 'not signed in' >&2; exit 1"})
+	if err == nil || !strings.Contains(err.Error(), "not signed in") {
+		t.Errorf("expected the command's stderr in the error, got %v", err)
+	}
+
+	// Slow commands of different models don't wait for each other, a shared one runs once
+	calls := filepath.Join(t.TempDir(), "calls")
+	slow := "sleep 0.3; printf x >> " + calls + "; echo "
+	commands := []string{slow + "key-a", slow + "key-b", slow + "key-a"}
+	keys := make([]string, len(commands))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, command := range commands {
+		wg.Add(1)
+		go func(i int, command string) {
+			defer wg.Done()
+			keys[i], _ = config.ResolveAPIKey(context.Background(), config.ModelConfig{APIKeyCommand: command})
+		}(i, command)
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 550*time.Millisecond {
+		t.Errorf("expected the commands to run concurrently, took %s", elapsed)
+	}
+	if keys[0] != "key-a" || keys[1] != "key-b" || keys[2] != "key-a" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if data, _ := os.ReadFile(calls); len(data) != 2 {
+		t.Errorf("expected 2 command runs, got %d", len(data))
+	}
+
+	// The caller's context bounds the command
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := config.ResolveAPIKey(ctx, config.ModelConfig{APIKeyCommand: "sleep 5; echo late"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline of the context, got %v", err)
+	}
+}
+
+func TestResolveEnvInModels(t *testing.T) {
+	t.Setenv("TMUXAI_TEST_TENANT", "tenant-2")
+	t.Setenv("TMUXAI_TEST_KEY", "env-key")
+
+	cfg := &config.Config{Models: map[string]config.ModelConfig{
+		"gateway": {APIKey: "${TMUXAI_TEST_KEY}", Headers: map[string]string{"x-tenant-id": "$TMUXAI_TEST_TENANT"}},
+	}}
+	config.ResolveEnvKeyInConfig(cfg)
+
+	gateway := cfg.Models["gateway"]
+	if gateway.APIKey != "env-key" {
+		t.Errorf("expected the api_key to be expanded, got %q", gateway.APIKey)
+	}
+	if gateway.Headers["x-tenant-id"] != "tenant-2" {
+		t.Errorf("expected the header to be expanded, got %q", gateway.Headers["x-tenant-id"])
+	}
+}
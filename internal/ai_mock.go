@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// MockEntry is a scripted response of the mock provider.
+// An entry with a turn only answers that request, one with a match only answers when the
+// regex matches the last user message. Entries with neither are replayed once each, in order.
+type MockEntry struct {
+	Turn      int    `yaml:"turn" json:"turn"`
+	Match     string `yaml:"match" json:"match"`
+	Response  string `yaml:"response" json:"response"`
+	Reasoning string `yaml:"reasoning" json:"reasoning"` // reasoning summary shown before the response
+	Delay     string `yaml:"delay" json:"delay"`         // simulated latency, e.g. "500ms"
+
+	match *regexp.Regexp
+	delay time.Duration
+}
+
+// MockScript is the state of a mock provider script during the session
+type MockScript struct {
+	Responses []MockEntry `yaml:"responses" json:"responses"`
+
+	mu   sync.Mutex
+	turn int
+	used map[int]bool
+}
+
+// loadMockScript reads a script from YAML, or from JSONL with one entry per line if the file ends in .jsonl
+func loadMockScript(path string) (*MockScript, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock script: %w", err)
+	}
+
+	script := &MockScript{used: make(map[int]bool)}
+	if strings.EqualFold(filepath.Ext(path), ".jsonl") {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			var entry MockEntry
+			if err := json.Unmarshal([]byte(text), &entry); err != nil {
+				return nil, fmt.Errorf("invalid mock script entry on line %d: %w", line, err)
+			}
+			script.Responses = append(script.Responses, entry)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read mock script: %w", err)
+		}
+	} else if err := yaml.Unmarshal(data, script); err != nil {
+		return nil, fmt.Errorf("failed to parse mock script: %w", err)
+	}
+
+	for i := range script.Responses {
+		entry := &script.Responses[i]
+		if entry.Match != "" {
+			if entry.match, err = regexp.Compile(entry.Match); err != nil {
+				return nil, fmt.Errorf("invalid match in mock script entry %d: %w", i+1, err)
+			}
+		}
+		if entry.Delay != "" {
+			if entry.delay, err = time.ParseDuration(entry.Delay); err != nil {
+				return nil, fmt.Errorf("invalid delay in mock script entry %d: %w", i+1, err)
+			}
+		}
+	}
+	return script, nil
+}
+
+// next returns the entry answering the next request, given the last user message
+func (s *MockScript) next(lastUserMessage string) (MockEntry, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.turn++
+	for i, entry := range s.Responses {
+		switch {
+		case entry.Turn != 0 || entry.match != nil:
+			if entry.Turn != 0 && entry.Turn != s.turn {
+				continue
+			}
+			if entry.match != nil && !entry.match.MatchString(lastUserMessage) {
+				continue
+			}
+		case s.used[i]:
+			continue
+		default:
+			s.used[i] = true
+		}
+		return entry, s.turn, nil
+	}
+	return MockEntry{}, s.turn, fmt.Errorf("mock script has no response for turn %d", s.turn)
+}
+
+// mockScript returns the loaded script of a mock model, loading it on first use
+func (c *AiClient) mockScript(path string) (*MockScript, error) {
+	if path == "" {
+		return nil, fmt.Errorf("mock provider requires a script")
+	}
+
+	c.mocksMu.Lock()
+	defer c.mocksMu.Unlock()
+
+	if script, ok := c.mocks[path]; ok {
+		return script, nil
+	}
+	script, err := loadMockScript(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.mocks == nil {
+		c.mocks = make(map[string]*MockScript)
+	}
+	c.mocks[path] = script
+	return script, nil
+}
+
+// MockChat answers from the script of a mock model, without any network access
+func (c *AiClient) MockChat(ctx context.Context, messages []Message, model string) (string, error) {
+	modelConfig, _ := c.currentModelConfig(ctx)
+	script, err := c.mockScript(modelConfig.Script)
+	if err != nil {
+		logger.Error("Failed to load mock script: %v", err)
+		return "", err
+	}
+
+	var lastUserMessage string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			lastUserMessage = messages[i].Content
+			break
+		}
+	}
+
+	entry, turn, err := script.next(lastUserMessage)
+	if err != nil {
+		logger.Error("Mock provider: %v", err)
+		return "", err
+	}
+	logger.Debug("Mock provider answering turn %d for model: %s", turn, model)
+
+	if entry.delay > 0 {
+		select {
+		case <-time.After(entry.delay):
+		case <-ctx.Done():
+			return "", fmt.Errorf("request canceled: %w", ctx.Err())
+		}
+	}
+
+	var input strings.Builder
+	for _, msg := range messages {
+		input.WriteString(msg.Content)
+		input.WriteString("\n")
+	}
+	tokenizer := tokenizerFor(modelConfig)
+	c.recordUsage(ctx, model, Usage{
+		InputTokens:     tokenizer.CountTokens(input.String()),
+		OutputTokens:    tokenizer.CountTokens(entry.Response),
+		ReasoningTokens: tokenizer.CountTokens(entry.Reasoning),
+	})
+
+	emitReasoning(ctx, entry.Reasoning)
+	if onDelta := streamHandlerFromContext(ctx); onDelta != nil {
+		onDelta(entry.Response)
+	}
+	return entry.Response, nil
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeMockScript(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestMockProviderYAMLScript(t *testing.T) {
+	script := writeMockScript(t, "script.yaml", `responses:
+  - match: "(?i)disk usage"
+    response: "<ExecCommand>df -h</ExecCommand>"
+  - turn: 3
+    response: "third"
+  - response: "first"
+  - response: "second"
+`)
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "mock", Model: "demo", Script: script})
+	assert.True(t, manager.hasValidAIConfiguration())
+
+	ask := func(message string) (string, error) {
+		return client.GetResponseFromChatMessages(context.Background(), []ChatMessage{
+			{Content: "system prompt"},
+			{Content: message, FromUser: true},
+		}, "demo")
+	}
+
+	response, err := ask("hello")
+	require.NoError(t, err)
+	assert.Equal(t, "first", response)
+
+	response, err = ask("show me the Disk Usage")
+	require.NoError(t, err)
+	assert.Equal(t, "<ExecCommand>df -h</ExecCommand>", response)
+
+	response, err = ask("and now?")
+	require.NoError(t, err)
+	assert.Equal(t, "third", response)
+
+	response, err = ask("again")
+	require.NoError(t, err)
+	assert.Equal(t, "second", response)
+
+	_, err = ask("one more")
+	assert.ErrorContains(t, err, "no response for turn 5")
+
+	assert.Equal(t, 4, manager.usageTracker().Total().Requests)
+}
+
+func TestMockProviderJSONLScript(t *testing.T) {
+	script := writeMockScript(t, "script.jsonl", `# replayed from a bug report
+{"response": "one"}
+
+{"response": "two", "delay": "1ms"}
+`)
+	_, client := newTestClient(t, config.ModelConfig{Provider: "mock", Model: "demo", Script: script})
+
+	var streamed strings.Builder
+	ctx := WithStreamHandler(context.Background(), func(delta string) { streamed.WriteString(delta) })
+	for _, want := range []string{"one", "two"} {
+		response, err := client.GetResponseFromChatMessages(ctx, []ChatMessage{{Content: "hi", FromUser: true}}, "demo")
+		require.NoError(t, err)
+		assert.Equal(t, want, response)
+	}
+	assert.Equal(t, "onetwo", streamed.String())
+}
+
+func TestMockProviderInvalidScript(t *testing.T) {
+	_, err := loadMockScript(writeMockScript(t, "bad.yaml", "responses:\n  - match: \"(\"\n    response: x\n"))
+	assert.ErrorContains(t, err, "invalid match")
+
+	_, err = loadMockScript(writeMockScript(t, "bad.jsonl", "{not json}\n"))
+	assert.ErrorContains(t, err, "line 1")
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "mock", Model: "demo"})
+	_, err = client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "demo")
+	assert.ErrorContains(t, err, "requires a script")
+}
+
+func TestProcessUserMessageWithMockProvider(t *testing.T) {
+	script := writeMockScript(t, "script.yaml", `responses:
+  - match: "check the logs"
+    response: "The logs look fine.\n<RequestAccomplished>1</RequestAccomplished>"
+`)
+	manager, _ := newTestClient(t, config.ModelConfig{Provider: "mock", Model: "demo", Script: script})
+	manager.getTmuxPanesInXml = func(config *config.Config) string {
+		return "<tmux>mock pane content</tmux>"
+	}
+
+	accomplished := manager.ProcessUserMessage(context.Background(), "please check the logs")
+
+	assert.True(t, accomplished)
+	assert.Equal(t, "", manager.Status)
+	require.Len(t, manager.Messages, 2)
+	assert.Contains(t, manager.Messages[1].Content, "The logs look fine.")
+}
+
+func TestProcessUserMessageKeepsReasoningOutOfHistory(t *testing.T) {
+	script := writeMockScript(t, "script.yaml", `responses:
+  - reasoning: "The user wants the logs checked."
+    response: "The logs look fine.\n<RequestAccomplished>1</RequestAccomplished>"
+`)
+	manager, _ := newTestClient(t, config.ModelConfig{Provider: "mock", Model: "demo", Script: script, ReasoningSummary: "auto"})
+	manager.getTmuxPanesInXml = func(config *config.Config) string {
+		return "<tmux>mock pane content</tmux>"
+	}
+	assert.True(t, manager.showReasoning(RoleChat))
+
+	assert.True(t, manager.ProcessUserMessage(context.Background(), "please check the logs"))
+	require.Len(t, manager.Messages, 2)
+	for _, msg := range manager.Messages {
+		assert.NotContains(t, msg.Content, "The user wants the logs checked.")
+	}
+}
@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+const (
+	ollamaDefaultBaseURL = "http://localhost:11434"
+	ollamaTagsTimeout    = 3 * time.Second
+)
+
+// OllamaRequest represents a request to the Ollama chat API
+type OllamaRequest struct {
+	Model     string                 `json:"model"`
+	Messages  []Message              `json:"messages"`
+	Stream    bool                   `json:"stream"` // Ollama streams unless told otherwise
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+}
+
+// OllamaResponse represents a response, or a streamed chunk of one, from the Ollama chat API
+type OllamaResponse struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
+	EvalCount       int     `json:"eval_count,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// OllamaTagsResponse represents the list of local models returned by /api/tags
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+// OllamaModel represents a single local model reported by Ollama
+type OllamaModel struct {
+	Name  string `json:"name"`
+	Model string `json:"model"`
+	Size  int64  `json:"size"`
+}
+
+// ollamaBaseURL normalizes the configured base URL, accepting the OpenAI compatible /v1 suffix
+func ollamaBaseURL(baseURL string) string {
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+	if baseURL == "" {
+		return ollamaDefaultBaseURL
+	}
+	return baseURL
+}
+
+// ollamaOptions maps the model configuration onto Ollama's model options
+func ollamaOptions(modelConfig config.ModelConfig) map[string]interface{} {
+	options := map[string]interface{}{}
+	if modelConfig.NumCtx > 0 {
+		options["num_ctx"] = modelConfig.NumCtx
+	}
+	if modelConfig.Temperature != nil {
+		options["temperature"] = *modelConfig.Temperature
+	}
+	if modelConfig.TopP != nil {
+		options["top_p"] = *modelConfig.TopP
+	}
+	if modelConfig.MaxTokens > 0 {
+		options["num_predict"] = modelConfig.MaxTokens
+	}
+	if len(modelConfig.Stop) > 0 {
+		options["stop"] = modelConfig.Stop
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+// OllamaChat sends a request to the Ollama chat API
+func (c *AiClient) OllamaChat(ctx context.Context, messages []Message, model string) (string, error) {
+	onDelta := streamHandlerFromContext(ctx)
+	reqBody := OllamaRequest{
+		Model:    model,
+		Messages: messages,
+		Stream:   onDelta != nil,
+	}
+
+	var baseURL string
+	var headers map[string]string
+	if c.configMgr != nil {
+		if modelConfig, exists := c.currentModelConfig(ctx); exists && modelConfig.Provider == "ollama" {
+			baseURL = modelConfig.BaseURL
+			headers = modelConfig.Headers
+			reqBody.KeepAlive = modelConfig.KeepAlive
+			reqBody.Options = ollamaOptions(modelConfig)
+		}
+	}
+	url := ollamaBaseURL(baseURL) + "/api/chat"
+
+	reqJSON, err := json.Marshal(reqBody)
+	if err != nil {
+		logger.Error("Failed to marshal Ollama request: %v", err)
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqJSON))
+	if err != nil {
+		logger.Error("Failed to create Ollama request: %v", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setHeaders(req, headers)
+
+	logger.Debug("Sending Ollama API request to: %s with model: %s", url, model)
+
+	resp, err := c.doWithRetry(ctx, req)
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return "", fmt.Errorf("request canceled: %w", ctx.Err())
+		}
+		logger.Error("Failed to send Ollama request: %v", err)
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusOK && onDelta != nil {
+		return c.readOllamaStream(ctx, resp.Body, onDelta, model)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("Failed to read Ollama response: %v", err)
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	logger.Debug("Ollama API response status: %d, response size: %d bytes", resp.StatusCode, len(body))
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("Ollama API returned error: %s", body)
+		return "", &APIStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var response OllamaResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		logger.Error("Failed to unmarshal Ollama response: %v, body: %s", err, body)
+		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if response.Error != "" {
+		logger.Error("Ollama API returned error: %s", response.Error)
+		return "", &APIError{Message: response.Error}
+	}
+
+	c.recordUsage(ctx, model, Usage{InputTokens: response.PromptEvalCount, OutputTokens: response.EvalCount})
+
+	if response.Message.Content == "" {
+		logger.Error("No response content returned. Raw response: %s", string(body))
+		return "", fmt.Errorf("no response content returned (model: %s, status: %d)", model, resp.StatusCode)
+	}
+
+	logger.Debug("Received Ollama response (%d characters): %s", len(response.Message.Content), response.Message.Content)
+	return response.Message.Content, nil
+}
+
+// readOllamaStream accumulates a streamed Ollama response, which is sent as newline delimited JSON
+func (c *AiClient) readOllamaStream(ctx context.Context, body io.Reader, onDelta StreamHandler, model string) (string, error) {
+	var content strings.Builder
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk OllamaResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			logger.Error("Failed to unmarshal Ollama stream chunk: %v, data: %s", err, line)
+			return "", fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			logger.Error("Ollama API returned error: %s", chunk.Error)
+			return "", &APIError{Message: chunk.Error}
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		if chunk.Done {
+			c.recordUsage(ctx, model, Usage{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount})
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() == context.Canceled {
+			return "", fmt.Errorf("request canceled: %w", ctx.Err())
+		}
+		logger.Error("Failed to read Ollama stream: %v", err)
+		return "", fmt.Errorf("failed to read response stream: %w", err)
+	}
+
+	if content.Len() == 0 {
+		logger.Error("No content in streamed Ollama response (model: %s)", model)
+		return "", fmt.Errorf("no response content returned (model: %s)", model)
+	}
+
+	logger.Debug("Received streamed Ollama response (%d characters): %s", content.Len(), content.String())
+	return content.String(), nil
+}
+
+// fetchOllamaModels returns the names of the models available on the Ollama server of a model,
+// connecting with the model's proxy, TLS settings and headers like a chat request would
+func (c *AiClient) fetchOllamaModels(ctx context.Context, modelConfig config.ModelConfig) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaTagsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ollamaBaseURL(modelConfig.BaseURL)+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setHeaders(req, modelConfig.Headers)
+
+	client, err := c.httpClientFor(modelConfig)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var tags OllamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	names := make([]string, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		name := model.Name
+		if name == "" {
+			name = model.Model
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// responseChain remembers the last response stored by the Responses API,
+// so the next turn only has to send what the server does not know yet
+type responseChain struct {
+	ID           string
+	Model        string
+	Instructions string
+	Input        []Message // everything the stored response knows, including its own answer
+	CallIDs      []string  // function calls of the stored response still waiting for their output
+}
+
+// responseTurn describes how the current Responses API request continues the chain
+type responseTurn struct {
+	PreviousID   string
+	Model        string
+	Instructions string
+	Input        []Message // full input of this turn
+	NewInput     []Message // part of the input the server does not know yet
+	CallIDs      []string  // function calls of the previous response answered by this turn
+}
+
+// functionCallOutput is the note sent as the output of a function call. TmuxAI reports
+// what came of the calls in its next message, the same way it does for XML tags.
+const functionCallOutput = "Handled by TmuxAI, the outcome follows in the next message."
+
+// ResponseFunctionCallOutput answers a function call of the previous response
+type ResponseFunctionCallOutput struct {
+	Type   string `json:"type"`
+	CallID string `json:"call_id"`
+	Output string `json:"output"`
+}
+
+// input returns the items to send for the turn, answering the pending function calls first
+func (t *responseTurn) input() ResponseInput {
+	if len(t.CallIDs) == 0 {
+		return t.NewInput
+	}
+	items := make([]interface{}, 0, len(t.CallIDs)+len(t.NewInput))
+	for _, id := range t.CallIDs {
+		items = append(items, ResponseFunctionCallOutput{Type: "function_call_output", CallID: id, Output: functionCallOutput})
+	}
+	for _, msg := range t.NewInput {
+		items = append(items, msg)
+	}
+	return items
+}
+
+// responseTurnFor returns the turn to send for a stateful conversation,
+// or nil when the model does not keep state on the server
+func (c *AiClient) responseTurnFor(ctx context.Context, model, instructions string, input []Message) *responseTurn {
+	if c.configMgr == nil {
+		return nil
+	}
+	modelConfig, exists := c.currentModelConfig(ctx)
+	if !exists || modelConfig.Provider != "openai" || modelConfig.Stateless {
+		return nil
+	}
+
+	turn := &responseTurn{Model: model, Instructions: instructions, Input: input, NewInput: input}
+	chain := c.configMgr.ResponseChain
+	// Instructions are never carried over by the server, they are sent every turn anyway
+	if chain != nil && chain.Model == model && chain.Instructions == instructions && hasMessagePrefix(input, chain.Input) {
+		turn.PreviousID = chain.ID
+		turn.NewInput = input[len(chain.Input):]
+		turn.CallIDs = chain.CallIDs
+		logger.Debug("Continuing response %s, sending %d of %d input messages", chain.ID, len(turn.NewInput), len(input))
+	}
+	return turn
+}
+
+// hasMessagePrefix reports whether messages starts with prefix and continues after it
+func hasMessagePrefix(messages, prefix []Message) bool {
+	if len(prefix) == 0 || len(messages) <= len(prefix) {
+		return false
+	}
+	for i, msg := range prefix {
+		if messages[i].Role != msg.Role || messages[i].Content != msg.Content {
+			return false
+		}
+	}
+	return true
+}
+
+// rememberResponse makes the stored response the head of the chain.
+// Its function calls are answered by the next turn that continues the chain.
+func (c *AiClient) rememberResponse(turn *responseTurn, id, text string, toolCalls []ToolCall) {
+	if turn == nil {
+		return
+	}
+	if id == "" {
+		c.configMgr.resetResponseChain()
+		return
+	}
+
+	var callIDs []string
+	if len(toolCalls) > 0 {
+		// The calls are kept in the history as XML tags, match the answer as it will be sent again
+		text = strings.TrimSpace(text + "\n" + toolCallsToXML(toolCalls))
+		for _, call := range toolCalls {
+			callIDs = append(callIDs, call.ID)
+		}
+	}
+
+	input := make([]Message, 0, len(turn.Input)+1)
+	input = append(input, turn.Input...)
+	input = append(input, Message{Role: "assistant", Content: text})
+	c.configMgr.ResponseChain = &responseChain{
+		ID:           id,
+		Model:        turn.Model,
+		Instructions: turn.Instructions,
+		Input:        input,
+		CallIDs:      callIDs,
+	}
+}
+
+// isChainExpired reports whether a request failed because the previous response is no longer available
+func isChainExpired(turn *responseTurn, err error) bool {
+	if turn == nil || turn.PreviousID == "" {
+		return false
+	}
+	var statusErr *APIStatusError
+	return errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusBadRequest)
+}
+
+// resetResponseChain makes the next Responses API request resend the full conversation
+func (m *Manager) resetResponseChain() {
+	m.ResponseChain = nil
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responsesRecorder is a Responses API server that records the requests it receives
+type responsesRecorder struct {
+	requests []ResponseRequest
+	inputs   [][]Message
+	failPrev bool // reject requests continuing a previous response
+}
+
+func (rr *responsesRecorder) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var raw struct {
+			ResponseRequest
+			Input []Message `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&raw))
+		rr.requests = append(rr.requests, raw.ResponseRequest)
+		rr.inputs = append(rr.inputs, raw.Input)
+
+		if rr.failPrev && raw.PreviousResponseID != "" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"message":"Previous response not found"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id":"resp_%d","output_text":"answer %d"}`, len(rr.requests), len(rr.requests))
+	}
+}
+
+func TestResponsesChainSendsOnlyNewTurn(t *testing.T) {
+	recorder := &responsesRecorder{}
+	server := httptest.NewServer(recorder.handler(t))
+	defer server.Close()
+
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "openai", Model: "gpt-5", APIKey: "key", BaseURL: server.URL})
+	ctx := context.Background()
+
+	history := []ChatMessage{
+		{Content: "system prompt"},
+		{Content: "first question", FromUser: true},
+	}
+	answer, err := client.GetResponseFromChatMessages(ctx, history, "gpt-5")
+	require.NoError(t, err)
+
+	history = append(history,
+		ChatMessage{Content: answer},
+		ChatMessage{Content: "second question", FromUser: true},
+	)
+	_, err = client.GetResponseFromChatMessages(ctx, history, "gpt-5")
+	require.NoError(t, err)
+
+	require.Len(t, recorder.requests, 2)
+	assert.True(t, recorder.requests[0].Store)
+	assert.Empty(t, recorder.requests[0].PreviousResponseID)
+	assert.Len(t, recorder.inputs[0], 1)
+
+	assert.Equal(t, "resp_1", recorder.requests[1].PreviousResponseID)
+	assert.Equal(t, "system prompt", recorder.requests[1].Instructions, "instructions are not carried over by the server")
+	require.Len(t, recorder.inputs[1], 1)
+	assert.Equal(t, "second question", recorder.inputs[1][0].Content)
+
+	// After /clear, /squash, a persona or model switch everything is sent again
+	manager.resetResponseChain()
+	history = append(history, ChatMessage{Content: "answer 2"}, ChatMessage{Content: "third question", FromUser: true})
+	_, err = client.GetResponseFromChatMessages(ctx, history, "gpt-5")
+	require.NoError(t, err)
+	assert.Empty(t, recorder.requests[2].PreviousResponseID)
+	assert.Len(t, recorder.inputs[2], 5)
+}
+
+func TestResponsesChainResendsWhenHistoryDiffers(t *testing.T) {
+	recorder := &responsesRecorder{}
+	server := httptest.NewServer(recorder.handler(t))
+	defer server.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "openai", Model: "gpt-5", APIKey: "key", BaseURL: server.URL})
+	ctx := context.Background()
+
+	_, err := client.GetResponseFromChatMessages(ctx, []ChatMessage{{Content: "system prompt"}, {Content: "question", FromUser: true}}, "gpt-5")
+	require.NoError(t, err)
+
+	// A different persona prompt means the stored response can't be continued
+	_, err = client.GetResponseFromChatMessages(ctx, []ChatMessage{
+		{Content: "another persona"},
+		{Content: "question", FromUser: true},
+		{Content: "answer 1"},
+		{Content: "next", FromUser: true},
+	}, "gpt-5")
+	require.NoError(t, err)
+	assert.Empty(t, recorder.requests[1].PreviousResponseID)
+	assert.Len(t, recorder.inputs[1], 3)
+}
+
+func TestResponsesChainExpired(t *testing.T) {
+	recorder := &responsesRecorder{failPrev: true}
+	server := httptest.NewServer(recorder.handler(t))
+	defer server.Close()
+
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "openai", Model: "gpt-5", APIKey: "key", BaseURL: server.URL})
+	manager.ResponseChain = &responseChain{
+		ID:           "resp_old",
+		Model:        "gpt-5",
+		Instructions: "system prompt",
+		Input:        []Message{{Role: "user", Content: "question"}, {Role: "assistant", Content: "answer"}},
+	}
+
+	resp, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{
+		{Content: "system prompt"},
+		{Content: "question", FromUser: true},
+		{Content: "answer"},
+		{Content: "next", FromUser: true},
+	}, "gpt-5")
+	require.NoError(t, err)
+	assert.Equal(t, "answer 2", resp)
+
+	require.Len(t, recorder.requests, 2)
+	assert.Equal(t, "resp_old", recorder.requests[0].PreviousResponseID)
+	assert.Empty(t, recorder.requests[1].PreviousResponseID)
+	assert.Len(t, recorder.inputs[1], 3)
+	require.NotNil(t, manager.ResponseChain)
+	assert.Equal(t, "resp_2", manager.ResponseChain.ID)
+}
+
+func TestResponsesStateless(t *testing.T) {
+	recorder := &responsesRecorder{}
+	server := httptest.NewServer(recorder.handler(t))
+	defer server.Close()
+
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "openai", Model: "gpt-5", APIKey: "key", BaseURL: server.URL, Stateless: true})
+	_, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "system prompt"}, {Content: "question", FromUser: true}}, "gpt-5")
+	require.NoError(t, err)
+
+	assert.False(t, recorder.requests[0].Store)
+	assert.Nil(t, manager.ResponseChain)
+}
+
+func TestResponsesChainThroughToolCalls(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			_, _ = w.Write([]byte(`{"id":"resp_1","output":[` +
+				`{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Listing files."}]},` +
+				`{"type":"function_call","call_id":"call_1","name":"TmuxSendKeys","arguments":"{\"keys\":[\"ls\",\"Enter\"]}"}]}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"id":"resp_%d","output_text":"done"}`, len(requests))
+	}))
+	defer server.Close()
+
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "openai", Model: "gpt-5", APIKey: "key", BaseURL: server.URL, ToolCalling: "native"})
+
+	session := &toolSession{Tools: actionTools(false, false)}
+	ctx := withToolSession(context.Background(), session)
+
+	history := []ChatMessage{
+		{Content: "system prompt"},
+		{Content: "list the files", FromUser: true},
+	}
+	answer, err := client.GetResponseFromChatMessages(ctx, history, "gpt-5")
+	require.NoError(t, err)
+	require.Len(t, session.Calls, 1)
+	require.NotNil(t, manager.ResponseChain, "tool calls keep the chain")
+	assert.Equal(t, []string{"call_1"}, manager.ResponseChain.CallIDs)
+
+	// The calls are kept in the history as XML tags, like the agent loop does
+	history = append(history,
+		ChatMessage{Content: strings.TrimSpace(answer + "\n" + toolCallsToXML(session.Calls))},
+		ChatMessage{Content: "pane output", FromUser: true},
+	)
+	_, err = client.GetResponseFromChatMessages(ctx, history, "gpt-5")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "resp_1", requests[1]["previous_response_id"])
+	input, _ := requests[1]["input"].([]interface{})
+	require.Len(t, input, 2)
+	output, _ := input[0].(map[string]interface{})
+	assert.Equal(t, "function_call_output", output["type"])
+	assert.Equal(t, "call_1", output["call_id"])
+	assert.NotEmpty(t, output["output"])
+	message, _ := input[1].(map[string]interface{})
+	assert.Equal(t, "pane output", message["content"])
+
+	require.NotNil(t, manager.ResponseChain)
+	assert.Equal(t, "resp_2", manager.ResponseChain.ID)
+	assert.Empty(t, manager.ResponseChain.CallIDs, "the calls were answered")
+}
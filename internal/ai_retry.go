@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/briandowns/spinner"
+)
+
+const (
+	defaultMaxAttempts = 3
+	retryMaxDelay      = 30 * time.Second
+	retryAfterMaxDelay = 2 * time.Minute
+)
+
+// retryBaseDelay is the delay before the first retry, doubled on every further attempt
+var retryBaseDelay = 1 * time.Second
+
+// isRetryableStatus reports whether a provider response is worth retrying
+func isRetryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// maxAttempts returns the number of attempts allowed for the current model, including the first one
+func (c *AiClient) maxAttempts(ctx context.Context) int {
+	if modelConfig, exists := c.currentModelConfig(ctx); exists && modelConfig.MaxAttempts > 0 {
+		return modelConfig.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+// doWithRetry sends the request, retrying rate limits, server errors and network failures
+// with exponential backoff and jitter. A Retry-After header from the provider takes precedence.
+// The last response or error is returned as is once all attempts are used up.
+func (c *AiClient) doWithRetry(ctx context.Context, req *http.Request) (*http.Response, error) {
+	maxAttempts := c.maxAttempts(ctx)
+	client, err := c.httpClient(ctx)
+	if err != nil {
+		logger.Error("Failed to set up HTTP client: %v", err)
+		return nil, err
+	}
+	if c.configMgr != nil {
+		defer c.configMgr.setRetryState("")
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+
+		resp, err := client.Do(attemptReq)
+		if ctx.Err() != nil || attempt >= maxAttempts {
+			return resp, err
+		}
+
+		var reason string
+		var delay time.Duration
+		switch {
+		case err != nil:
+			reason = "Request failed"
+			delay = backoffDelay(attempt)
+			logger.Warn("Request to %s failed (attempt %d/%d): %v", req.URL.Host, attempt, maxAttempts, err)
+		case isRetryableStatus(resp.StatusCode):
+			reason = fmt.Sprintf("Provider returned %d", resp.StatusCode)
+			if resp.StatusCode == http.StatusTooManyRequests {
+				reason = "Rate limited (429)"
+			}
+			delay = backoffDelay(attempt)
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			_ = resp.Body.Close()
+			logger.Warn("Request to %s returned %d (attempt %d/%d): %s", req.URL.Host, resp.StatusCode, attempt, maxAttempts, body)
+		default:
+			return resp, nil
+		}
+
+		logger.Info("%s, retrying in %s (attempt %d/%d)", reason, delay, attempt+1, maxAttempts)
+		if c.configMgr != nil {
+			c.configMgr.setRetryState(fmt.Sprintf("%s, retry %d/%d in %s", reason, attempt+1, maxAttempts, delay.Round(100*time.Millisecond)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// setRetryState shows the retry of the request in progress in the prompt line, empty once it is done
+func (m *Manager) setRetryState(state string) {
+	m.retryState.Store(state)
+}
+
+// RetryState returns the retry of the request in progress, empty when it isn't retried
+func (m *Manager) RetryState() string {
+	state, _ := m.retryState.Load().(string)
+	return state
+}
+
+// showRetries makes a spinner show the prompt line while a request is retried, see doWithRetry
+func (m *Manager) showRetries(s *spinner.Spinner) {
+	s.PreUpdate = func(s *spinner.Spinner) {
+		s.Prefix = ""
+		if m.RetryState() != "" {
+			s.Prefix = m.GetPrompt()
+		}
+	}
+}
+
+// backoffDelay returns an exponentially growing delay with jitter for the given attempt
+func backoffDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	// equal jitter: half of the delay is fixed, the other half random
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = time.Until(date)
+	} else {
+		return 0, false
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > retryAfterMaxDelay {
+		delay = retryAfterMaxDelay
+	}
+	return delay, true
+}
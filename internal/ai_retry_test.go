@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func withRetryBaseDelay(t *testing.T, d time.Duration) {
+	previous := retryBaseDelay
+	retryBaseDelay = d
+	t.Cleanup(func() { retryBaseDelay = previous })
+}
+
+func TestRetryOnRateLimit(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"message":"slow down"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewAiClient(&config.Config{
+		OpenRouter: config.OpenRouterConfig{APIKey: "test-key", BaseURL: server.URL},
+	})
+	resp, err := client.ChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, "model")
+	if err != nil {
+		t.Fatalf("ChatCompletion error: %v", err)
+	}
+	if resp != "ok" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryOnServerErrorGivesUp(t *testing.T) {
+	withRetryBaseDelay(t, time.Millisecond)
+
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := NewAiClient(&config.Config{
+		OpenRouter: config.OpenRouterConfig{APIKey: "test-key", BaseURL: server.URL},
+	})
+	_, err := client.ChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, "model")
+	if err == nil {
+		t.Fatal("expected an error after exhausting retries")
+	}
+	if attempts != defaultMaxAttempts {
+		t.Errorf("expected %d attempts, got %d", defaultMaxAttempts, attempts)
+	}
+}
+
+func TestRetryDoesNotRetryClientErrors(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := NewAiClient(&config.Config{
+		OpenRouter: config.OpenRouterConfig{APIKey: "test-key", BaseURL: server.URL},
+	})
+	if _, err := client.ChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, "model"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", attempts)
+	}
+}
+
+func TestRetryShownInPrompt(t *testing.T) {
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key"})
+	var attempts int32
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prompts = append(prompts, manager.GetPrompt())
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+	modelConfig := manager.Config.Models["main"]
+	modelConfig.BaseURL = server.URL
+	manager.Config.Models["main"] = modelConfig
+
+	if _, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "test-model"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(prompts) != 2 || strings.Contains(prompts[0], "retry") || !strings.Contains(prompts[1], "Rate limited (429), retry 2/3 in 0s") {
+		t.Errorf("expected the retry in the prompt of the second attempt, got %q", prompts)
+	}
+	if state := manager.RetryState(); state != "" {
+		t.Errorf("expected the retry state to be cleared, got %q", state)
+	}
+}
+
+func TestRetryHonorsMaxAttempts(t *testing.T) {
+	withRetryBaseDelay(t, time.Millisecond)
+
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "local",
+			Models: map[string]config.ModelConfig{
+				"local": {Provider: "ollama", Model: "llama3", BaseURL: server.URL, MaxAttempts: 1},
+			},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+	client := NewAiClient(manager.Config)
+	client.SetConfigManager(manager)
+
+	if _, err := client.OllamaChat(context.Background(), []Message{{Role: "user", Content: "hi"}}, "llama3"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("expected retries to be disabled, got %d attempts", attempts)
+	}
+}
+
+func TestRetryCanceledWhileWaiting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := NewAiClient(&config.Config{
+		OpenRouter: config.OpenRouterConfig{APIKey: "test-key", BaseURL: server.URL},
+	})
+	start := time.Now()
+	_, err := client.ChatCompletion(ctx, []Message{{Role: "user", Content: "hi"}}, "model")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("retry wait was not interrupted by cancellation")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("5"); !ok || d != 5*time.Second {
+		t.Errorf("unexpected seconds delay: %v %v", d, ok)
+	}
+	if d, ok := parseRetryAfter("3600"); !ok || d != retryAfterMaxDelay {
+		t.Errorf("expected delay to be capped, got %v", d)
+	}
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(date); !ok || d <= 0 || d > 10*time.Second {
+		t.Errorf("unexpected date delay: %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Errorf("expected invalid header to be rejected")
+	}
+}
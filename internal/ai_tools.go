@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"context"
+	"sort"
+)
+
+// ToolCall represents a function call requested by the model
+type ToolCall struct {
+	Index    int              `json:"index,omitempty"` // position while streaming chat completions
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction holds the name and JSON encoded arguments of a tool call
+type ToolCallFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// ToolDefinition describes a tool offered to the model as a JSON schema
+type ToolDefinition struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+}
+
+// toolSession carries the tools offered for a request and collects the calls the model made
+type toolSession struct {
+	Tools []ToolDefinition
+	Calls []ToolCall
+}
+
+// calls returns the tool calls collected so far, it is safe to call on a nil session
+func (s *toolSession) calls() []ToolCall {
+	if s == nil {
+		return nil
+	}
+	return s.Calls
+}
+
+type toolSessionKey struct{}
+
+// withToolSession returns a context in which models configured for native tool calling
+// are offered the tools of the session and report their calls back into it
+func withToolSession(ctx context.Context, session *toolSession) context.Context {
+	return context.WithValue(ctx, toolSessionKey{}, session)
+}
+
+// nativeToolSession returns the tool session of the request when the model in use calls tools natively
+func (c *AiClient) nativeToolSession(ctx context.Context) *toolSession {
+	session, ok := ctx.Value(toolSessionKey{}).(*toolSession)
+	if !ok || len(session.Tools) == 0 {
+		return nil
+	}
+	if modelConfig, exists := c.currentModelConfig(ctx); !exists || modelConfig.ToolCalling != "native" {
+		return nil
+	}
+	return session
+}
+
+func noParameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+
+func stringParameter(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			name: map[string]interface{}{"type": "string", "description": description},
+		},
+		"required": []string{name},
+	}
+}
+
+// withPaneParameter adds the optional pane an action is for, the tools' equivalent of the pane attribute
+func withPaneParameter(parameters map[string]interface{}) map[string]interface{} {
+	properties := parameters["properties"].(map[string]interface{})
+	properties["pane"] = map[string]interface{}{"type": "string", "description": "Id of a writable pane to act in, e.g. %2. Leave out for the exec pane"}
+	return parameters
+}
+
+// actionTools declares the XML tags of the prompts as tools
+func actionTools(watchMode, prepared bool) []ToolDefinition {
+	if watchMode {
+		return []ToolDefinition{
+			{Name: "NoComment", Description: "No response is needed for the current pane content", Parameters: noParameters()},
+		}
+	}
+
+	tools := []ToolDefinition{
+		{Name: "TmuxSendKeys", Description: "Send keystrokes to the tmux pane. Supports characters, function keys (F1-F12), navigation keys (Up, Down, Enter, Escape, Tab, ...) and modifiers (C-, M-)", Parameters: withPaneParameter(sendKeysParameters())},
+		{Name: "ExecCommand", Description: "Execute a shell command in the tmux pane", Parameters: withPaneParameter(stringParameter("command", "The shell command to execute"))},
+		{Name: "PasteMultilineContent", Description: "Paste multiline content into the tmux pane, e.g. into an editor. Never use it to run shell commands", Parameters: withPaneParameter(stringParameter("content", "The content to paste"))},
+		{Name: "WaitingForUserResponse", Description: "You have a question or need input from the user", Parameters: noParameters()},
+		{Name: "RequestAccomplished", Description: "You have completed and verified the user's request", Parameters: noParameters()},
+	}
+	if !prepared {
+		tools = append(tools, ToolDefinition{Name: "ExecPaneSeemsBusy", Description: "Wait for the exec pane to finish before proceeding", Parameters: noParameters()})
+	}
+	return tools
+}
+
+func sendKeysParameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"keys": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Keys to send in order, e.g. [\"vim example.txt\", \"Enter\"]",
+			},
+		},
+		"required": []string{"keys"},
+	}
+}
+
+// chatCompletionTools converts the tool definitions to the chat completions format
+func chatCompletionTools(tools []ToolDefinition) []interface{} {
+	result := make([]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		result = append(result, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"parameters":  tool.Parameters,
+			},
+		})
+	}
+	return result
+}
+
+// responsesTools converts the tool definitions to the Responses API format
+func responsesTools(tools []ToolDefinition) []interface{} {
+	result := make([]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		result = append(result, map[string]interface{}{
+			"type":        "function",
+			"name":        tool.Name,
+			"description": tool.Description,
+			"parameters":  tool.Parameters,
+		})
+	}
+	return result
+}
+
+// toolCallAccumulator assembles tool calls from streamed chat completion deltas
+type toolCallAccumulator map[int]*ToolCall
+
+func (a toolCallAccumulator) add(delta ToolCall) {
+	call, ok := a[delta.Index]
+	if !ok {
+		call = &ToolCall{Index: delta.Index}
+		a[delta.Index] = call
+	}
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+	if delta.Type != "" {
+		call.Type = delta.Type
+	}
+	call.Function.Name += delta.Function.Name
+	call.Function.Arguments += delta.Function.Arguments
+}
+
+func (a toolCallAccumulator) calls() []ToolCall {
+	indexes := make([]int, 0, len(a))
+	for index := range a {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	calls := make([]ToolCall, 0, len(a))
+	for _, index := range indexes {
+		calls = append(calls, *a[index])
+	}
+	return calls
+}
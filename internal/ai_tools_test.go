@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatCompletionNativeTools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		tools, _ := req["tools"].([]interface{})
+		assert.Len(t, tools, len(actionTools(false, false)))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Listing files.","tool_calls":[` +
+			`{"id":"call_1","type":"function","function":{"name":"ExecCommand","arguments":"{\"command\":\"ls -l\"}"}}]}}]}`))
+	}))
+	defer server.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: server.URL, ToolCalling: "native"})
+	session := &toolSession{Tools: actionTools(false, false)}
+	ctx := withToolSession(context.Background(), session)
+
+	resp, err := client.GetResponseFromChatMessages(ctx, []ChatMessage{{Content: "hi", FromUser: true}}, "test-model")
+	require.NoError(t, err)
+	assert.Equal(t, "Listing files.", resp)
+	require.Len(t, session.Calls, 1)
+	assert.Equal(t, "ExecCommand", session.Calls[0].Function.Name)
+}
+
+func TestChatCompletionXMLModeSendsNoTools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.NotContains(t, req, "tools")
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"<RequestAccomplished>1</RequestAccomplished>"}}]}`))
+	}))
+	defer server.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: server.URL})
+	session := &toolSession{Tools: actionTools(false, false)}
+	ctx := withToolSession(context.Background(), session)
+
+	_, err := client.GetResponseFromChatMessages(ctx, []ChatMessage{{Content: "hi", FromUser: true}}, "test-model")
+	require.NoError(t, err)
+	assert.Empty(t, session.Calls)
+}
+
+func TestChatCompletionStreamedToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"TmuxSendKeys\",\"arguments\":\"\"}}]}}]}\n\n"))
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"keys\\\":[\\\"vim\\\",\"}}]}}]}\n\n"))
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"Enter\\\"]}\"}}]}}]}\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: server.URL, ToolCalling: "native"})
+	session := &toolSession{Tools: actionTools(false, false)}
+	ctx := withToolSession(WithStreamHandler(context.Background(), func(string) {}), session)
+
+	resp, err := client.GetResponseFromChatMessages(ctx, []ChatMessage{{Content: "hi", FromUser: true}}, "test-model")
+	require.NoError(t, err)
+	assert.Empty(t, resp)
+	require.Len(t, session.Calls, 1)
+	assert.Equal(t, `{"keys":["vim","Enter"]}`, session.Calls[0].Function.Arguments)
+}
+
+func TestResponsesNativeTools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		tools, _ := req["tools"].([]interface{})
+		require.NotEmpty(t, tools)
+		first, _ := tools[0].(map[string]interface{})
+		assert.Equal(t, "function", first["type"])
+		assert.NotEmpty(t, first["name"], "Responses API tools are not nested under function")
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","output":[{"type":"function_call","call_id":"call_1","name":"RequestAccomplished","arguments":"{}"}]}`))
+	}))
+	defer server.Close()
+
+	_, client := newTestClient(t, config.ModelConfig{Provider: "openai", Model: "test-model", APIKey: "key", BaseURL: server.URL, ToolCalling: "native"})
+	session := &toolSession{Tools: actionTools(false, true)}
+	ctx := withToolSession(context.Background(), session)
+
+	resp, err := client.GetResponseFromChatMessages(ctx, []ChatMessage{{Content: "hi", FromUser: true}}, "test-model")
+	require.NoError(t, err)
+	assert.Empty(t, resp)
+	require.Len(t, session.Calls, 1)
+	assert.Equal(t, "RequestAccomplished", session.Calls[0].Function.Name)
+}
+
+func TestApplyToolCalls(t *testing.T) {
+	calls := []ToolCall{
+		{Function: ToolCallFunction{Name: "TmuxSendKeys", Arguments: `{"keys":["vim a<b>.txt","Enter"]}`}},
+		{Function: ToolCallFunction{Name: "WaitingForUserResponse", Arguments: `{}`}},
+		{Function: ToolCallFunction{Name: "Unknown"}},
+	}
+
+	r := AIResponse{Message: "Opening the file."}
+	require.NoError(t, applyToolCalls(&r, calls))
+	assert.Equal(t, []string{"vim a<b>.txt", "Enter"}, r.SendKeys)
+	assert.True(t, r.WaitingForUserResponse)
+
+	// The XML kept in the history parses back to the same actions
+	m := &Manager{}
+	parsed, err := m.parseAIResponse("Opening the file.\n" + toolCallsToXML(calls))
+	require.NoError(t, err)
+	assert.Equal(t, r.SendKeys, parsed.SendKeys)
+	assert.True(t, parsed.WaitingForUserResponse)
+	assert.Equal(t, "Opening the file.", parsed.Message)
+
+	err = applyToolCalls(&r, []ToolCall{{Function: ToolCallFunction{Name: "ExecCommand", Arguments: "{not json"}}})
+	assert.Error(t, err)
+}
+
+func TestApplyToolCalls_Pane(t *testing.T) {
+	calls := []ToolCall{
+		{Function: ToolCallFunction{Name: "ExecCommand", Arguments: `{"command":"make test","pane":"%3"}`}},
+		{Function: ToolCallFunction{Name: "ExecCommand", Arguments: `{"command":"make lint","pane":"%3"}`}},
+	}
+	r := AIResponse{}
+	require.NoError(t, applyToolCalls(&r, calls))
+	assert.Equal(t, "%3", r.Pane)
+
+	m := &Manager{}
+	parsed, err := m.parseAIResponse(toolCallsToXML(calls))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"make test", "make lint"}, parsed.ExecCommand)
+	assert.Equal(t, "%3", parsed.Pane)
+
+	// Actions split across panes are left to the guidelines check
+	r = AIResponse{}
+	require.NoError(t, applyToolCalls(&r, []ToolCall{calls[0], {Function: ToolCallFunction{Name: "ExecCommand", Arguments: `{"command":"ls"}`}}}))
+	assert.Equal(t, "pane %3 and the exec pane", r.PaneConflict)
+}
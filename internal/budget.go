@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// dailySpendFile stores today's spend under the config directory so the daily budget holds across restarts
+const dailySpendFile = "spend.json"
+
+// dailySpend is the persisted spend of a single day
+type dailySpend struct {
+	Date string  `json:"date"` // local date, YYYY-MM-DD
+	Cost float64 `json:"cost"` // USD
+}
+
+// usageCost returns the cost in USD of the usage according to the model pricing
+func usageCost(modelConfig config.ModelConfig, usage Usage) float64 {
+	return (float64(usage.InputTokens)*modelConfig.InputPrice + float64(usage.OutputTokens)*modelConfig.OutputPrice) / 1_000_000
+}
+
+func dailySpendPath() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, dailySpendFile), nil
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// loadDailySpend returns the spend recorded for the given day, a spend of an earlier day counts as zero
+func loadDailySpend(path, day string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read daily spend: %w", err)
+	}
+
+	var spend dailySpend
+	if err := json.Unmarshal(data, &spend); err != nil {
+		return 0, fmt.Errorf("failed to parse daily spend: %w", err)
+	}
+	if spend.Date != day {
+		return 0, nil
+	}
+	return spend.Cost, nil
+}
+
+// addDailySpend adds cost to the spend of the given day and returns the new total
+func addDailySpend(path, day string, cost float64) (float64, error) {
+	total, err := loadDailySpend(path, day)
+	if err != nil {
+		logger.Error("Resetting daily spend: %v", err)
+		total = 0
+	}
+	total += cost
+
+	data, err := json.Marshal(dailySpend{Date: day, Cost: total})
+	if err != nil {
+		return total, fmt.Errorf("failed to marshal daily spend: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return total, fmt.Errorf("failed to write daily spend: %w", err)
+	}
+	return total, nil
+}
+
+// recordSpend persists the cost of a request into today's spend
+func (m *Manager) recordSpend(cost float64) {
+	path, err := dailySpendPath()
+	if err != nil {
+		logger.Error("Failed to record daily spend: %v", err)
+		return
+	}
+	if _, err := addDailySpend(path, today(), cost); err != nil {
+		logger.Error("Failed to record daily spend: %v", err)
+	}
+}
+
+// GetDailySpend returns the spend of today across all sessions
+func (m *Manager) GetDailySpend() float64 {
+	path, err := dailySpendPath()
+	if err != nil {
+		logger.Error("Failed to load daily spend: %v", err)
+		return 0
+	}
+	spend, err := loadDailySpend(path, today())
+	if err != nil {
+		logger.Error("Failed to load daily spend: %v", err)
+	}
+	return spend
+}
+
+// checkBudget returns an error explaining why the next request must not be sent,
+// when it would exceed the session or the daily budget
+func (m *Manager) checkBudget(messages []ChatMessage) error {
+	var models []config.ModelConfig
+	if modelConfig, exists := m.GetCurrentModelConfig(); exists {
+		models = append(models, modelConfig)
+	}
+	return m.checkBudgetFor(models, messages)
+}
+
+// checkBudgetFor returns an error when sending the messages to each of the models would exceed
+// the session or the daily budget, /compare sends them to several models at once
+func (m *Manager) checkBudgetFor(models []config.ModelConfig, messages []ChatMessage) error {
+	sessionBudget := m.GetSessionBudget()
+	dailyBudget := m.GetDailyBudget()
+	if sessionBudget <= 0 && dailyBudget <= 0 {
+		return nil
+	}
+
+	// Only the prompt can be estimated before sending, the answer is paid for afterwards
+	var estimated float64
+	if len(models) > 0 {
+		var tokens int
+		for _, msg := range messages {
+			tokens += m.countTokens(msg.Content)
+		}
+		for _, modelConfig := range models {
+			estimated += usageCost(modelConfig, Usage{InputTokens: tokens})
+		}
+	}
+
+	if sessionBudget > 0 {
+		spent := m.usageTracker().Total().Cost
+		if spent+estimated > sessionBudget {
+			return fmt.Errorf("session budget of $%.2f would be exceeded ($%.4f spent, next request ~$%.4f). Raise it with /config set session_budget <usd>", sessionBudget, spent, estimated)
+		}
+	}
+
+	if dailyBudget > 0 {
+		spent := m.GetDailySpend()
+		if spent+estimated > dailyBudget {
+			return fmt.Errorf("daily budget of $%.2f would be exceeded ($%.4f spent today, next request ~$%.4f). Raise it with /config set daily_budget <usd>", dailyBudget, spent, estimated)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageCost(t *testing.T) {
+	modelConfig := config.ModelConfig{InputPrice: 3, OutputPrice: 15}
+	cost := usageCost(modelConfig, Usage{InputTokens: 1_000_000, OutputTokens: 100_000})
+	assert.InDelta(t, 4.5, cost, 1e-9)
+}
+
+func TestDailySpendPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), dailySpendFile)
+
+	spend, err := loadDailySpend(path, "2026-01-01")
+	require.NoError(t, err)
+	assert.Zero(t, spend)
+
+	_, err = addDailySpend(path, "2026-01-01", 0.25)
+	require.NoError(t, err)
+	total, err := addDailySpend(path, "2026-01-01", 0.5)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.75, total, 1e-9)
+
+	// A new day starts from zero
+	spend, err = loadDailySpend(path, "2026-01-02")
+	require.NoError(t, err)
+	assert.Zero(t, spend)
+	total, err = addDailySpend(path, "2026-01-02", 0.1)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.1, total, 1e-9)
+}
+
+func TestRecordedCostIsPersisted(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":1000,"completion_tokens":100,"total_tokens":1100}}`))
+	}))
+	defer server.Close()
+
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: server.URL, InputPrice: 2, OutputPrice: 10})
+
+	_, err := client.GetResponseFromChatMessages(context.Background(), []ChatMessage{{Content: "hi", FromUser: true}}, "test-model")
+	require.NoError(t, err)
+
+	assert.InDelta(t, 0.003, manager.Usage.Total().Cost, 1e-9)
+	assert.InDelta(t, 0.003, manager.GetDailySpend(), 1e-9)
+}
+
+func TestCheckBudget(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "main",
+			Models: map[string]config.ModelConfig{
+				"main": {Provider: "openrouter", Model: "test-model", InputPrice: 1, OutputPrice: 1},
+			},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+	messages := []ChatMessage{{Content: "hello", FromUser: true}}
+
+	assert.NoError(t, manager.checkBudget(messages), "no budget configured")
+
+	manager.Config.SessionBudget = 1
+	manager.recordUsage("main", Usage{Requests: 1, Cost: 0.5})
+	assert.NoError(t, manager.checkBudget(messages))
+
+	manager.recordUsage("main", Usage{Requests: 1, Cost: 0.5})
+	err := manager.checkBudget(messages)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "session budget")
+
+	// A session override raises the limit, the daily budget still applies
+	manager.SessionOverrides["session_budget"] = config.TryInferType("session_budget", "5")
+	manager.Config.DailyBudget = 0.9
+	err = manager.checkBudget(messages)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "daily budget")
+
+	manager.Config.DailyBudget = math.MaxFloat64
+	assert.NoError(t, manager.checkBudget(messages))
+}
+
+func TestProcessUserMessage_BudgetExceeded(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	manager := &Manager{
+		Config: &config.Config{
+			SessionBudget: 0.01,
+			OpenRouter:    config.OpenRouterConfig{APIKey: "key", Model: "test-model"},
+		},
+		Status:           "running",
+		Messages:         []ChatMessage{},
+		SessionOverrides: make(map[string]interface{}),
+		ExecPane:         &system.TmuxPaneDetails{},
+	}
+	manager.recordUsage("test-model", Usage{Requests: 1, Cost: 0.02})
+
+	mockAiClient := &MockAiClient{}
+	manager.AiClient = mockAiClient
+	manager.getTmuxPanesInXml = func(config *config.Config) string {
+		return "<tmux>mock pane content</tmux>"
+	}
+
+	result := manager.ProcessUserMessage(context.Background(), "test message")
+
+	assert.False(t, result)
+	assert.Equal(t, "", manager.Status, "the agent loop should stop")
+	mockAiClient.AssertNotCalled(t, "GetResponseFromChatMessages", mock.Anything, mock.Anything, mock.Anything)
+}
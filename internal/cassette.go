@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// recordedHeaders are the request headers written to a cassette as they are, all others are redacted:
+// besides the API keys, the headers configured for a model often carry tenant or gateway tokens
+var recordedHeaders = map[string]bool{
+	"Accept":            true,
+	"Accept-Encoding":   true,
+	"Anthropic-Beta":    true,
+	"Anthropic-Version": true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"User-Agent":        true,
+}
+
+// Interaction is a single recorded HTTP exchange with a provider
+type Interaction struct {
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers,omitempty"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	StatusCode      int         `json:"status_code,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	ResponseBody    string      `json:"response_body,omitempty"`
+	Error           string      `json:"error,omitempty"` // transport error, e.g. a timeout
+}
+
+// Cassette records the HTTP traffic of the AI client to a directory, one JSON file per
+// request, or replays a recorded directory so a session can be re-run without network.
+// Replayed requests are matched to the recording by method, URL and body, so requests
+// sent concurrently get their own answers whatever order they arrive in.
+type Cassette struct {
+	dir    string
+	replay bool
+
+	mu           sync.Mutex
+	count        int
+	interactions []Interaction
+	played       []bool // interactions already served during replay
+}
+
+// NewRecordingCassette returns a cassette recording into dir, which must be empty or not exist yet
+func NewRecordingCassette(dir string) (*Cassette, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette directory: %w", err)
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("cassette directory %s already contains a recording", dir)
+	}
+	return &Cassette{dir: dir}, nil
+}
+
+// NewReplayCassette returns a cassette replaying the interactions recorded in dir
+func NewReplayCassette(dir string) (*Cassette, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette directory: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded interactions in %s", dir)
+	}
+	sort.Strings(files)
+
+	c := &Cassette{dir: dir, replay: true}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", filepath.Base(file), err)
+		}
+		c.interactions = append(c.interactions, interaction)
+	}
+	c.played = make([]bool, len(c.interactions))
+	return c, nil
+}
+
+// SetCassette makes the AI client record its HTTP traffic to, or replay it from, the cassette
+func (m *Manager) SetCassette(cassette *Cassette) {
+	if client, ok := m.AiClient.(*AiClient); ok {
+		client.SetCassette(cassette)
+	}
+}
+
+// Transport wraps the transport of an http.Client with the cassette
+func (c *Cassette) Transport(next http.RoundTripper) http.RoundTripper {
+	return &cassetteTransport{cassette: c, next: next}
+}
+
+type cassetteTransport struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cassette.replay {
+		return t.cassette.play(req)
+	}
+	return t.cassette.record(req, t.next)
+}
+
+// play serves the first recorded interaction not served yet with the method, URL and body of the request
+func (c *Cassette) play(req *http.Request) (*http.Response, error) {
+	var body string
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		body = string(data)
+	}
+
+	c.mu.Lock()
+	if c.count >= len(c.interactions) {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("cassette %s exhausted after %d interactions", c.dir, len(c.interactions))
+	}
+	match := -1
+	for i, recorded := range c.interactions {
+		if !c.played[i] && recorded.Method == req.Method && recorded.URL == req.URL.String() && recorded.RequestBody == body {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("cassette %s has no recorded interaction left for %s %s with this body", c.dir, req.Method, req.URL)
+	}
+	c.played[match] = true
+	c.count++
+	interaction := c.interactions[match]
+	c.mu.Unlock()
+
+	logger.Debug("Replaying interaction %d for %s %s", match+1, req.Method, req.URL)
+	if interaction.Error != "" {
+		return nil, errors.New(interaction.Error)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+		StatusCode:    interaction.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        interaction.ResponseHeaders.Clone(),
+		Body:          io.NopCloser(strings.NewReader(interaction.ResponseBody)),
+		ContentLength: int64(len(interaction.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+// record sends the request and saves the exchange once the response body has been read,
+// so streamed responses still reach the caller as they arrive
+func (c *Cassette) record(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	interaction := Interaction{
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeaders: redactHeaders(req.Header),
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		interaction.RequestBody = string(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	c.mu.Lock()
+	c.count++
+	path := filepath.Join(c.dir, fmt.Sprintf("%04d.json", c.count))
+	c.mu.Unlock()
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		interaction.Error = err.Error()
+		c.save(path, interaction)
+		return nil, err
+	}
+
+	interaction.StatusCode = resp.StatusCode
+	interaction.ResponseHeaders = resp.Header.Clone()
+	resp.Body = &recordingBody{ReadCloser: resp.Body, done: func(body []byte) {
+		interaction.ResponseBody = string(body)
+		c.save(path, interaction)
+	}}
+	return resp, nil
+}
+
+func (c *Cassette) save(path string, interaction Interaction) {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, data, 0o600)
+	}
+	if err != nil {
+		logger.Error("Failed to record interaction to %s: %v", path, err)
+		return
+	}
+	logger.Debug("Recorded %s %s to %s", interaction.Method, interaction.URL, path)
+}
+
+// redactHeaders returns a copy of the headers with the values of all but the recordedHeaders removed
+func redactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+	for name := range redacted {
+		if !recordedHeaders[http.CanonicalHeaderKey(name)] {
+			redacted.Set(name, "REDACTED")
+		}
+	}
+	return redacted
+}
+
+// recordingBody keeps a copy of everything read from a response body and hands it to done
+// once the body is fully read or closed
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	once sync.Once
+	done func([]byte)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.buf.Bytes()) })
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.once.Do(func() { b.done(b.buf.Bytes()) })
+	return b.ReadCloser.Close()
+}
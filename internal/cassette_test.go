@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	withRetryBaseDelay(t, time.Millisecond)
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"first answer"}}]}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"streamed \"}}]}\n\n"))
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"answer\"}}]}\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+
+	dir := filepath.Join(t.TempDir(), "session")
+	messages := []ChatMessage{{Content: "hi", FromUser: true}}
+
+	recorder, err := NewRecordingCassette(dir)
+	require.NoError(t, err)
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: server.URL})
+	manager.SetCassette(recorder)
+
+	response, err := client.GetResponseFromChatMessages(context.Background(), messages, "test-model")
+	require.NoError(t, err)
+	assert.Equal(t, "first answer", response)
+
+	var streamed strings.Builder
+	streamCtx := WithStreamHandler(context.Background(), func(delta string) { streamed.WriteString(delta) })
+	response, err = client.GetResponseFromChatMessages(streamCtx, messages, "test-model")
+	require.NoError(t, err)
+	assert.Equal(t, "streamed answer", response)
+	assert.Equal(t, "streamed answer", streamed.String())
+	server.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	recorded, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(recorded), `"REDACTED"`)
+	assert.NotContains(t, string(recorded), "Bearer key")
+
+	_, err = NewRecordingCassette(dir)
+	assert.ErrorContains(t, err, "already contains a recording")
+
+	// Replay works without the server
+	player, err := NewReplayCassette(dir)
+	require.NoError(t, err)
+	manager, client = newTestClient(t, config.ModelConfig{Provider: "openrouter", Model: "test-model", APIKey: "key", BaseURL: server.URL})
+	manager.SetCassette(player)
+
+	response, err = client.GetResponseFromChatMessages(context.Background(), messages, "test-model")
+	require.NoError(t, err)
+	assert.Equal(t, "first answer", response)
+
+	streamed.Reset()
+	response, err = client.GetResponseFromChatMessages(streamCtx, messages, "test-model")
+	require.NoError(t, err)
+	assert.Equal(t, "streamed answer", response)
+	assert.Equal(t, "streamed answer", streamed.String())
+
+	_, err = client.GetResponseFromChatMessages(context.Background(), messages, "test-model")
+	assert.ErrorContains(t, err, "exhausted after 2 interactions")
+}
+
+// Test: Replayed requests get the answer recorded for them, whatever order they arrive in
+func TestCassetteReplayMatchesRequests(t *testing.T) {
+	dir := t.TempDir()
+	for i, prompt := range []string{"first", "second"} {
+		data, err := json.Marshal(Interaction{
+			Method:       http.MethodPost,
+			URL:          "https://api.example.com/v1/chat/completions",
+			RequestBody:  `{"prompt":"` + prompt + `"}`,
+			StatusCode:   http.StatusOK,
+			ResponseBody: "answer to " + prompt,
+		})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%04d.json", i+1)), data, 0o600))
+	}
+	player, err := NewReplayCassette(dir)
+	require.NoError(t, err)
+	transport := player.Transport(nil)
+
+	send := func(prompt string) (string, error) {
+		req, err := http.NewRequest(http.MethodPost, "https://api.example.com/v1/chat/completions", strings.NewReader(`{"prompt":"`+prompt+`"}`))
+		require.NoError(t, err)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	_, err = send("unknown")
+	assert.ErrorContains(t, err, "no recorded interaction left")
+
+	answer, err := send("second")
+	require.NoError(t, err)
+	assert.Equal(t, "answer to second", answer)
+	answer, err = send("first")
+	require.NoError(t, err)
+	assert.Equal(t, "answer to first", answer)
+
+	_, err = send("first")
+	assert.ErrorContains(t, err, "exhausted after 2 interactions")
+}
+
+func TestReplayCassetteEmptyDir(t *testing.T) {
+	_, err := NewReplayCassette(t.TempDir())
+	assert.ErrorContains(t, err, "no recorded interactions")
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer key")
+	headers.Set("X-Tenant-Token", "tenant-secret")
+	headers.Set("Content-Type", "application/json")
+	headers.Set("Anthropic-Version", "2023-06-01")
+
+	redacted := redactHeaders(headers)
+	assert.Equal(t, "REDACTED", redacted.Get("Authorization"))
+	assert.Equal(t, "REDACTED", redacted.Get("X-Tenant-Token"))
+	assert.Equal(t, "application/json", redacted.Get("Content-Type"))
+	assert.Equal(t, "2023-06-01", redacted.Get("Anthropic-Version"))
+	assert.Equal(t, "Bearer key", headers.Get("Authorization"), "the request keeps its headers")
+}
+
+func TestCassetteReplaysOllamaModelDiscovery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"models":[{"name":"llama3:8b"}]}`))
+	}))
+	dir := filepath.Join(t.TempDir(), "session")
+	manager, _ := newTestClient(t, config.ModelConfig{Provider: "ollama", Model: "test-model", APIKey: "key", BaseURL: server.URL})
+
+	recorder, err := NewRecordingCassette(dir)
+	require.NoError(t, err)
+	manager.SetCassette(recorder)
+	manager.discoverOllamaModels(context.Background())
+	assert.Equal(t, []string{"llama3:8b"}, manager.GetOllamaModels())
+	server.Close()
+
+	// Replay works without the server
+	player, err := NewReplayCassette(dir)
+	require.NoError(t, err)
+	manager.SetCassette(player)
+	manager.OllamaModels = nil
+	manager.discoverOllamaModels(context.Background())
+	assert.Equal(t, []string{"llama3:8b"}, manager.GetOllamaModels())
+}
@@ -123,10 +123,24 @@ func (c *CLIInterface) printWelcomeMessage() {
 
 func (c *CLIInterface) processInput(input string) {
 	if c.manager.IsMessageSubcommand(input) {
-		c.manager.ProcessSubCommand(input)
+		c.runCancellable(func(ctx context.Context) {
+			c.manager.ProcessSubCommand(ctx, input)
+		})
 		return
 	}
 
+	c.runCancellable(func(ctx context.Context) {
+		defer func() {
+			c.manager.Status = ""
+		}()
+
+		c.manager.Status = "running"
+		c.manager.ProcessUserMessage(ctx, input)
+	})
+}
+
+// runCancellable runs work with a context that Ctrl+C cancels, and waits for it to finish
+func (c *CLIInterface) runCancellable(work func(ctx context.Context)) {
 	// Set up signal handling for Ctrl+C
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
@@ -142,12 +156,7 @@ func (c *CLIInterface) processInput(input string) {
 	// Launch a goroutine for the message processing
 	go func() {
 		defer wg.Done()
-		defer func() {
-			c.manager.Status = ""
-		}()
-
-		c.manager.Status = "running"
-		c.manager.ProcessUserMessage(ctx, input)
+		work(ctx)
 	}()
 
 	// Wait for either the processing to finish or for an interrupt signal
@@ -201,6 +210,20 @@ func (c *CLIInterface) newCompleter() *completion.CmdCompletionOrList2 {
 				}
 			}
 
+			// Handle /dryrun subcommands
+			if len(field) > 0 && field[0] == "/dryrun" {
+				if len(field) == 1 || (len(field) == 2 && !strings.HasSuffix(field[1], " ")) {
+					return []string{"on", "off"}, []string{"on", "off"}
+				}
+			}
+
+			// Handle /pane subcommands
+			if len(field) > 0 && field[0] == "/pane" {
+				if len(field) == 1 || (len(field) == 2 && !strings.HasSuffix(field[1], " ")) {
+					return []string{"allow", "deny"}, []string{"allow", "deny"}
+				}
+			}
+
 			// Handle /kb subcommands
 			if len(field) > 0 && field[0] == "/kb" {
 				if len(field) == 1 || (len(field) == 2 && !strings.HasSuffix(field[1], " ")) {
@@ -230,8 +253,8 @@ func (c *CLIInterface) newCompleter() *completion.CmdCompletionOrList2 {
 			// Handle /model subcommands
 			if len(field) > 0 && field[0] == "/model" {
 				if len(field) == 1 || (len(field) == 2 && !strings.HasSuffix(field[1], " ")) {
-					// Return available models for completion
-					availableModels := c.manager.GetAvailableModels()
+					// Return available models for completion, including discovered local models
+					availableModels := append(c.manager.GetAvailableModels(), c.manager.GetOllamaModels()...)
 					if len(availableModels) == 0 {
 						return nil, nil
 					}
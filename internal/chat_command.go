@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sort"
@@ -23,6 +24,12 @@ const helpMessage = `Available commands:
 - /persona [name]: List available personas or switch to the specified one
 - /model: List available models and show current model
 - /model <name>: Switch to a different model
+- /usage: Show token usage for this session
+- /compare <model1,model2,...> <prompt>: Ask several models the same prompt and compare their answers
+- /plan <task>: Plan the task step by step, review the plan, then run it
+- /dryrun [on|off]: Show the actions the AI would take without sending anything to the panes
+- /pane: List the panes and whether the AI may act in them
+- /pane allow|deny <id>: Let the AI act in a pane, or make it read only again
 - /kb: List available knowledge bases
 - /kb load <name>: Load a knowledge base
 - /kb unload <name>: Unload a knowledge base
@@ -41,6 +48,11 @@ var commands = []string{
 	"/persona",
 	"/model",
 	"/kb",
+	"/usage",
+	"/compare",
+	"/plan",
+	"/dryrun",
+	"/pane",
 }
 
 // checks if the given content is a command
@@ -51,8 +63,8 @@ func (m *Manager) IsMessageSubcommand(content string) bool {
 	return strings.HasPrefix(content, "/")
 }
 
-// processes a command and returns a response
-func (m *Manager) ProcessSubCommand(command string) {
+// processes a command and returns a response, long running commands stop when ctx is canceled
+func (m *Manager) ProcessSubCommand(ctx context.Context, command string) {
 	commandLower := strings.ToLower(strings.TrimSpace(command))
 	logger.Info("Processing command: %s", command)
 
@@ -125,6 +137,8 @@ func (m *Manager) ProcessSubCommand(command string) {
 		time.Sleep(500 * time.Millisecond)
 		m.ExecPane.Refresh(m.GetMaxCaptureLines())
 		m.Messages = []ChatMessage{}
+		m.usageTracker().ResetLast()
+		m.resetResponseChain()
 
 		fmt.Println(m.ExecPane.String())
 		m.parseExecPaneCommandHistory()
@@ -138,12 +152,16 @@ func (m *Manager) ProcessSubCommand(command string) {
 
 	case prefixMatch(commandPrefix, "/clear"):
 		m.Messages = []ChatMessage{}
+		m.usageTracker().ResetLast()
+		m.resetResponseChain()
 		_ = system.TmuxClearPane(m.PaneId)
 		return
 
 	case prefixMatch(commandPrefix, "/reset"):
 		m.Status = ""
 		m.Messages = []ChatMessage{}
+		m.usageTracker().ResetLast()
+		m.resetResponseChain()
 		_ = system.TmuxClearPane(m.PaneId)
 		_ = system.TmuxClearPane(m.ExecPane.Id)
 		return
@@ -168,7 +186,7 @@ func (m *Manager) ProcessSubCommand(command string) {
 Watch for: ` + watchDesc
 			m.Status = "running"
 			m.WatchMode = true
-			m.startWatchMode(startWatch)
+			m.startWatchMode(ctx, startWatch)
 			return
 		}
 		m.Println("Usage: /watch <description>")
@@ -190,14 +208,14 @@ Watch for: ` + watchDesc
 					return true
 				}
 			}
-			return false
+			return IsModelOverrideKey(key)
 		}
 
 		// Check if it's "config set" for a specific key
 		if len(parts) >= 3 && parts[1] == "set" {
 			key := parts[2]
 			if !isKeyAllowed(key) {
-				m.Println(fmt.Sprintf("Cannot set '%s'. Only these keys are allowed: %s", key, strings.Join(AllowedConfigKeys, ", ")))
+				m.Println(fmt.Sprintf("Cannot set '%s'. Only these keys are allowed: %s, models.<name>.{%s}", key, strings.Join(AllowedConfigKeys, ", "), strings.Join(ModelOverrideKeys, ",")))
 				return
 			}
 			value := strings.Join(parts[3:], " ")
@@ -235,7 +253,7 @@ Watch for: ` + watchDesc
 				tokens := ""
 				if loaded {
 					status = "[✓]"
-					tokenCount := system.EstimateTokenCount(m.LoadedKBs[name])
+					tokenCount := m.countTokens(m.LoadedKBs[name])
 					tokens = fmt.Sprintf(" (%d tokens)", tokenCount)
 					totalTokens += tokenCount
 					loadedCount++
@@ -266,7 +284,7 @@ Watch for: ` + watchDesc
 				return
 			}
 
-			tokenCount := system.EstimateTokenCount(m.LoadedKBs[name])
+			tokenCount := m.countTokens(m.LoadedKBs[name])
 			m.Println(fmt.Sprintf("✓ Loaded knowledge base: %s (%d tokens)", name, tokenCount))
 			return
 
@@ -307,14 +325,73 @@ Watch for: ` + watchDesc
 		// Handle model commands: /model, /model <name>
 		if len(parts) == 1 {
 			// List available models and show current
-			m.listModels()
+			m.listModels(ctx)
 			return
 		} else if len(parts) >= 2 {
 			modelName := strings.Join(parts[1:], " ")
-			m.switchModel(modelName)
+			m.switchModel(ctx, modelName)
 			return
 		}
 
+	case prefixMatch(commandPrefix, "/usage"):
+		m.formatUsage()
+		return
+
+	case prefixMatch(commandPrefix, "/compare"):
+		m.compare(ctx, command)
+		return
+
+	case prefixMatch(commandPrefix, "/plan"):
+		parts := strings.Fields(command)
+		if len(parts) > 1 {
+			m.Status = "running"
+			m.runPlan(ctx, strings.Join(parts[1:], " "))
+			m.Status = ""
+			return
+		}
+		m.Println("Usage: /plan <task>")
+		return
+
+	case prefixMatch(commandPrefix, "/dryrun"):
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "on":
+				m.DryRun = true
+			case "off":
+				m.DryRun = false
+			default:
+				m.Println("Usage: /dryrun [on|off]")
+				return
+			}
+		}
+		if m.DryRun {
+			m.Println("Dry run is on: actions are shown but not sent to the panes.")
+		} else {
+			m.Println("Dry run is off.")
+		}
+		return
+
+	case prefixMatch(commandPrefix, "/pane"):
+		if len(parts) == 1 {
+			m.listPanes()
+			return
+		}
+		if len(parts) != 3 || (parts[1] != "allow" && parts[1] != "deny") {
+			m.Println("Usage: /pane [allow|deny <id>]")
+			return
+		}
+		writable := parts[1] == "allow"
+		if err := m.setPaneWritable(parts[2], writable); err != nil {
+			m.Println(err.Error())
+			return
+		}
+		if writable {
+			m.Println(fmt.Sprintf("The AI may now act in pane %s.", parts[2]))
+		} else {
+			m.Println(fmt.Sprintf("Pane %s is read only now.", parts[2]))
+		}
+		return
+
 	default:
 		m.Println(fmt.Sprintf("Unknown command: %s. Type '/help' to see available commands.", command))
 		return
@@ -344,6 +421,7 @@ func (m *Manager) switchPersona(name string) {
 
 	if persona, ok := m.Config.Personas[name]; ok {
 		m.CurrentPersona = name
+		m.resetResponseChain()
 		logger.Info("Successfully switched to persona: '%s'", name)
 		m.Println(fmt.Sprintf("Switched to persona: %s - %s", name, persona.Description))
 	} else {
@@ -371,6 +449,8 @@ func (m *Manager) formatInfo() {
 	formatLine("Version", Version)
 	formatLine("Max Capture Lines", m.Config.MaxCaptureLines)
 	formatLine("Wait Interval", m.Config.WaitInterval)
+	formatLine("Dry Run", m.DryRun)
+	formatLine("Writable Panes", strings.Join(m.writablePaneIds(), ", "))
 
 	// Display AI model information
 	currentModelConfig, _ := m.GetCurrentModelConfig()
@@ -389,6 +469,13 @@ func (m *Manager) formatInfo() {
 		if modelConfig, exists := m.GetModelConfig(modelName); exists {
 			formatLine("Provider", modelConfig.Provider)
 		}
+		if fallbacks := m.GetFallbackModels(); len(fallbacks) > 0 {
+			formatLine("Fallbacks", strings.Join(fallbacks, " → "))
+		}
+		// Models the other kinds of work are routed to, see model_roles
+		for _, role := range ModelRoleNames[1:] {
+			formatLine(strings.ToUpper(role[:1])+role[1:]+" Model", m.GetRoleModel(role))
+		}
 	} else {
 		// Legacy configuration
 		formatLine("Provider", currentModelConfig.Provider)
@@ -399,19 +486,33 @@ func (m *Manager) formatInfo() {
 	fmt.Println(formatter.FormatSection("\nContext"))
 	formatLine("Messages", len(m.Messages))
 	var totalTokens int
-	for _, msg := range m.Messages {
-		totalTokens += system.EstimateTokenCount(msg.Content)
+	contextLabel := "Context Size~"
+	if last, ok := m.usageTracker().Last(); ok {
+		// Tokens reported by the provider for the last request and its answer
+		totalTokens = last.TotalTokens()
+		contextLabel = "Context Size"
+	} else {
+		for _, msg := range m.Messages {
+			totalTokens += m.countTokens(msg.Content)
+		}
 	}
 
 	usagePercent := 0.0
 	if m.GetMaxContextSize() > 0 {
 		usagePercent = float64(totalTokens) / float64(m.GetMaxContextSize()) * 100
 	}
-	fmt.Print(formatter.LabelColor.Sprintf("%-*s", labelWidth, "Context Size~"))
+	fmt.Print(formatter.LabelColor.Sprintf("%-*s", labelWidth, contextLabel))
 	fmt.Print("  ") // Two spaces for separation
 	fmt.Printf("%s\n", fmt.Sprintf("%d tokens", totalTokens))
 	fmt.Printf("%-*s  %s\n", labelWidth, "", formatter.FormatProgressBar(usagePercent, 10))
-	formatLine("Max Size", fmt.Sprintf("%d tokens", m.GetMaxContextSize()))
+	maxSize, maxSizeSource := m.maxContextSize()
+	formatLine("Max Size", fmt.Sprintf("%d tokens (%s)", maxSize, maxSizeSource))
+	if maxOutput := m.GetMaxOutput(); maxOutput > 0 {
+		formatLine("Max Output", fmt.Sprintf("%d tokens", maxOutput))
+	}
+	if total := m.usageTracker().Total(); total.Requests > 0 {
+		formatLine("Session Tokens", fmt.Sprintf("%d (%d requests)", total.TotalTokens(), total.Requests))
+	}
 
 	// Display knowledge base information
 	if len(m.LoadedKBs) > 0 {
@@ -430,8 +531,62 @@ func (m *Manager) formatInfo() {
 	}
 }
 
+// formatUsage displays the token usage reported by the providers this session
+func (m *Manager) formatUsage() {
+	formatter := system.NewInfoFormatter()
+	const labelWidth = 18
+	formatUsageLine := func(key string, usage Usage) {
+		fmt.Print(formatter.LabelColor.Sprintf("%-*s", labelWidth, key))
+		fmt.Print("  ")
+		line := fmt.Sprintf("%d in / %d out", usage.InputTokens, usage.OutputTokens)
+		if usage.ReasoningTokens > 0 {
+			line += fmt.Sprintf(" (%d reasoning)", usage.ReasoningTokens)
+		}
+		line += fmt.Sprintf(", %d requests", usage.Requests)
+		if usage.Cost > 0 {
+			line += fmt.Sprintf(", $%.4f", usage.Cost)
+		}
+		fmt.Println(line)
+	}
+	formatBudget := func(key string, spent, budget float64) {
+		fmt.Print(formatter.LabelColor.Sprintf("%-*s", labelWidth, key))
+		fmt.Print("  ")
+		if budget > 0 {
+			fmt.Printf("$%.4f of $%.2f\n", spent, budget)
+		} else {
+			fmt.Printf("$%.4f (no limit)\n", spent)
+		}
+	}
+
+	tracker := m.usageTracker()
+	total := tracker.Total()
+	if total.Requests == 0 {
+		m.Println("No token usage reported yet.")
+		return
+	}
+
+	fmt.Println(formatter.FormatSection("\nSession"))
+	formatUsageLine("Total", total)
+	formatBudget("Session Spend", total.Cost, m.GetSessionBudget())
+	formatBudget("Today's Spend", m.GetDailySpend(), m.GetDailyBudget())
+
+	fmt.Println(formatter.FormatSection("\nBy Model"))
+	models, byModel := tracker.ByModel()
+	for _, name := range models {
+		formatUsageLine(name, byModel[name])
+	}
+
+	personas, byPersona := tracker.ByPersona()
+	if len(personas) > 0 {
+		fmt.Println(formatter.FormatSection("\nBy Persona"))
+		for _, name := range personas {
+			formatUsageLine(name, byPersona[name])
+		}
+	}
+}
+
 // listModels displays available models and highlights the current one
-func (m *Manager) listModels() {
+func (m *Manager) listModels(ctx context.Context) {
 	formatter := system.NewInfoFormatter()
 
 	// Get current model configuration
@@ -457,6 +612,20 @@ func (m *Manager) listModels() {
 		fmt.Println("No model configurations found. Using legacy configuration.")
 	}
 
+	// List local models reported by Ollama, these can be picked without a config entry
+	m.discoverOllamaModels(ctx)
+	ollamaModels := m.GetOllamaModels()
+	if len(ollamaModels) > 0 {
+		fmt.Println(formatter.FormatSection("\nLocal Ollama Models"))
+		for _, name := range ollamaModels {
+			status := " [ ]"
+			if currentDefault == name {
+				status = " [✓]"
+			}
+			fmt.Printf("%s %s (ollama: %s)\n", status, name, m.OllamaModels[name].BaseURL)
+		}
+	}
+
 	// Show current model from legacy config if no models configured
 	if len(availableModels) == 0 || currentDefault == "" {
 		fmt.Println("\nCurrent Model (Legacy):")
@@ -475,22 +644,28 @@ func (m *Manager) listModels() {
 		}
 	}
 
-	if len(availableModels) > 0 {
+	if len(availableModels) > 0 || len(ollamaModels) > 0 {
 		fmt.Println("\nUsage: /model <name> to switch models")
 	}
 }
 
 // switchModel switches to the specified model configuration
-func (m *Manager) switchModel(modelName string) {
-	// Check if the model exists in configurations
+func (m *Manager) switchModel(ctx context.Context, modelName string) {
+	// Check if the model exists in configurations, or is a local Ollama model
 	_, exists := m.GetModelConfig(modelName)
 	if !exists {
-		m.Println(fmt.Sprintf("Model '%s' not found. Available models: %s", modelName, strings.Join(m.GetAvailableModels(), ", ")))
+		m.discoverOllamaModels(ctx)
+		_, exists = m.GetModelConfig(modelName)
+	}
+	if !exists {
+		available := append(m.GetAvailableModels(), m.GetOllamaModels()...)
+		m.Println(fmt.Sprintf("Model '%s' not found. Available models: %s", modelName, strings.Join(available, ", ")))
 		return
 	}
 
 	// Set the model as default for this session
 	m.SetModelsDefault(modelName)
+	m.resetResponseChain()
 
 	// Get the model configuration to show details
 	modelConfig, _ := m.GetModelConfig(modelName)
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -54,7 +55,7 @@ func TestProcessSubCommand_PrepareSubshell(t *testing.T) {
 
 	// Test case 1: /prepare with valid shell on subshell (should work and send commands)
 	commandsSent = []string{} // Reset
-	manager.ProcessSubCommand("/prepare bash")
+	manager.ProcessSubCommand(context.Background(), "/prepare bash")
 
 	assert.Len(t, commandsSent, 2, "Should send PS1 command and clear command for bash")
 	assert.Contains(t, commandsSent[0], "PS1=", "Should send bash PS1 command")
@@ -62,7 +63,7 @@ func TestProcessSubCommand_PrepareSubshell(t *testing.T) {
 
 	// Test case 2: /prepare with zsh on subshell
 	commandsSent = []string{} // Reset
-	manager.ProcessSubCommand("/prepare zsh")
+	manager.ProcessSubCommand(context.Background(), "/prepare zsh")
 
 	assert.Len(t, commandsSent, 2, "Should send PROMPT command and clear command for zsh")
 	assert.Contains(t, commandsSent[0], "PROMPT=", "Should send zsh PROMPT command")
@@ -70,7 +71,7 @@ func TestProcessSubCommand_PrepareSubshell(t *testing.T) {
 
 	// Test case 3: /prepare with fish on subshell
 	commandsSent = []string{} // Reset
-	manager.ProcessSubCommand("/prepare fish")
+	manager.ProcessSubCommand(context.Background(), "/prepare fish")
 
 	assert.Len(t, commandsSent, 2, "Should send fish_prompt function and clear command for fish")
 	assert.Contains(t, commandsSent[0], "fish_prompt", "Should send fish prompt function")
@@ -78,7 +79,7 @@ func TestProcessSubCommand_PrepareSubshell(t *testing.T) {
 
 	// Test case 4: /prepare without shell specification on subshell (should not send commands, just print warning)
 	commandsSent = []string{} // Reset
-	manager.ProcessSubCommand("/prepare")
+	manager.ProcessSubCommand(context.Background(), "/prepare")
 
 	fmt.Println(commandsSent)
 	assert.Len(t, commandsSent, 0, "Should not send commands when no shell specified on subshell (should show warning instead)")
@@ -130,13 +131,13 @@ func TestProcessSubCommand_PrepareNormalShell(t *testing.T) {
 
 	// Test case 1: /prepare without shell specification when CurrentCommand is not a shell (should not send commands)
 	commandsSent = []string{} // Reset
-	manager.ProcessSubCommand("/prepare")
+	manager.ProcessSubCommand(context.Background(), "/prepare")
 
 	assert.Len(t, commandsSent, 0, "Should not send commands when CurrentCommand is not a supported shell")
 
 	// Test case 2: /prepare with explicit shell on normal shell (should work)
 	commandsSent = []string{} // Reset
-	manager.ProcessSubCommand("/prepare zsh")
+	manager.ProcessSubCommand(context.Background(), "/prepare zsh")
 
 	assert.Len(t, commandsSent, 2, "Should send commands when explicitly specifying shell on normal pane")
 	assert.Contains(t, commandsSent[0], "PROMPT=", "Should send zsh PROMPT command")
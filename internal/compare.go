@@ -0,0 +1,328 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/briandowns/spinner"
+	"github.com/fatih/color"
+	"golang.org/x/term"
+)
+
+// minCompareColumnWidth is the narrowest column answers are shown side by side in,
+// below that they are shown one after the other
+const minCompareColumnWidth = 40
+
+// compareResult is the answer of one model to a /compare prompt
+type compareResult struct {
+	Model    string
+	Response string
+	Parsed   AIResponse
+	Latency  time.Duration
+	Usage    Usage
+	Err      error
+}
+
+// parseCompareArgs splits "/compare <model1,model2,...> <prompt>" into the model names and the prompt
+func (m *Manager) parseCompareArgs(command string) ([]string, string, error) {
+	parts := strings.Fields(command)
+	if len(parts) < 3 {
+		return nil, "", fmt.Errorf("a list of models and a prompt are required")
+	}
+	// The prompt is kept as typed, with its line breaks and spacing
+	rest := strings.TrimLeft(command, " \t\n")
+	for _, part := range parts[:2] {
+		rest = strings.TrimLeft(strings.TrimPrefix(rest, part), " \t\n")
+	}
+
+	var models []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(parts[1], ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, exists := m.GetModelConfig(name); !exists {
+			return nil, "", fmt.Errorf("unknown model %s, available models: %s", name, strings.Join(m.GetAvailableModels(), ", "))
+		}
+		seen[name] = true
+		models = append(models, name)
+	}
+	if len(models) < 2 {
+		return nil, "", fmt.Errorf("at least two different models are required")
+	}
+
+	return models, strings.TrimRight(rest, " \t\n"), nil
+}
+
+// compareModels sends the same prompt, with the same history, to each model concurrently.
+// The answers are parsed but none of their actions are taken.
+// Models the budget has no room left for are not asked, their result is the budget error.
+func (m *Manager) compareModels(ctx context.Context, models []string, prompt string) (ChatMessage, []compareResult) {
+	history, currentMessage := m.composeHistory(prompt)
+	sending := append(history, currentMessage)
+
+	results := make([]compareResult, len(models))
+	var dispatched []config.ModelConfig
+	var wg sync.WaitGroup
+	for i, name := range models {
+		modelConfig, _ := m.GetModelConfig(name)
+		if err := m.checkBudgetFor(append(dispatched, modelConfig), sending); err != nil {
+			results[i] = compareResult{Model: name, Err: err}
+			continue
+		}
+		dispatched = append(dispatched, modelConfig)
+
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = m.askModel(ctx, sending, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Usage.Requests > 0 {
+			m.recordUsage(result.Model, result.Usage)
+		}
+		if m.Config.Debug {
+			if result.Err != nil {
+				debugModelExchange(result.Model, sending, "ERROR: "+result.Err.Error())
+			} else {
+				debugModelExchange(result.Model, sending, result.Response)
+			}
+		}
+	}
+	return currentMessage, results
+}
+
+// askModel gets and parses the answer of a single model, outside of the conversation
+func (m *Manager) askModel(ctx context.Context, sending []ChatMessage, name string) compareResult {
+	result := compareResult{Model: name}
+
+	tools := &toolSession{Tools: actionTools(m.WatchMode, m.ExecPane.IsPrepared)}
+	requestCtx := withToolSession(withPinnedModel(ctx, name, &result.Usage), tools)
+
+	start := time.Now()
+	response, err := m.AiClient.GetResponseFromChatMessages(requestCtx, sending, name)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	r, err := m.parseAIResponse(response)
+	if err == nil && len(tools.Calls) > 0 {
+		err = applyToolCalls(&r, tools.Calls)
+		response = strings.TrimSpace(response + "\n" + toolCallsToXML(tools.Calls))
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("failed to parse response: %w", err)
+		return result
+	}
+
+	result.Response = response
+	result.Parsed = r
+	return result
+}
+
+// compareHeader is the title of an answer: its number, model, latency and tokens
+func compareHeader(i int, result compareResult) string {
+	header := fmt.Sprintf("[%d] %s (%s", i+1, result.Model, result.Latency.Round(10*time.Millisecond))
+	if result.Usage.Requests > 0 {
+		header += fmt.Sprintf(", %d in / %d out", result.Usage.InputTokens, result.Usage.OutputTokens)
+	}
+	return header + ")"
+}
+
+// compareBody describes an answer: its message and the actions it would have taken
+func compareBody(result compareResult) []string {
+	if result.Err != nil {
+		return []string{"Error: " + result.Err.Error()}
+	}
+
+	r := result.Parsed
+	var lines []string
+	if message := strings.TrimSpace(r.Message); message != "" {
+		lines = append(lines, strings.Split(message, "\n")...)
+	}
+	for _, command := range r.ExecCommand {
+		lines = append(lines, "Would execute: "+command)
+	}
+	for _, keys := range r.SendKeys {
+		lines = append(lines, "Would send keys: "+keys)
+	}
+	if r.PasteMultilineContent != "" {
+		lines = append(lines, "Would paste:")
+		lines = append(lines, strings.Split(r.PasteMultilineContent, "\n")...)
+	}
+	switch {
+	case r.RequestAccomplished:
+		lines = append(lines, "Request accomplished")
+	case r.WaitingForUserResponse:
+		lines = append(lines, "Waiting for user response")
+	case r.ExecPaneSeemsBusy:
+		lines = append(lines, "Exec pane seems busy")
+	case r.NoComment:
+		lines = append(lines, "No comment")
+	}
+	return lines
+}
+
+// wrapText breaks text into lines of at most width characters, at spaces where possible
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// renderColumns lays out blocks of text side by side in columns of the given width
+func renderColumns(blocks [][]string, width int) []string {
+	columns := make([][]string, len(blocks))
+	height := 0
+	for i, block := range blocks {
+		for _, line := range block {
+			columns[i] = append(columns[i], wrapText(line, width)...)
+		}
+		height = max(height, len(columns[i]))
+	}
+
+	rows := make([]string, height)
+	for row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cell := ""
+			if row < len(column) {
+				cell = column[row]
+			}
+			cells[i] = cell + strings.Repeat(" ", width-utf8.RuneCountInString(cell))
+		}
+		rows[row] = strings.TrimRight(strings.Join(cells, " │ "), " ")
+	}
+	return rows
+}
+
+// printComparison shows the answers side by side when the terminal is wide enough, otherwise one after the other
+func (m *Manager) printComparison(results []compareResult) {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	columnWidth := 0
+	if err == nil && len(results) > 0 {
+		columnWidth = (width - 3*(len(results)-1)) / len(results)
+	}
+
+	if columnWidth >= minCompareColumnWidth {
+		blocks := make([][]string, len(results))
+		for i, result := range results {
+			blocks[i] = append([]string{compareHeader(i, result), strings.Repeat("─", columnWidth)}, compareBody(result)...)
+		}
+		fmt.Println(strings.Join(renderColumns(blocks, columnWidth), "\n"))
+		return
+	}
+
+	formatter := system.NewInfoFormatter()
+	for i, result := range results {
+		fmt.Println(formatter.FormatSection("\n" + compareHeader(i, result)))
+		for _, line := range compareBody(result) {
+			fmt.Println(line)
+		}
+	}
+}
+
+// adoptComparison adds the prompt and the chosen answer to the conversation, as if the model had answered it
+func (m *Manager) adoptComparison(currentMessage ChatMessage, result compareResult) {
+	m.Messages = append(m.Messages, currentMessage, ChatMessage{
+		Content:   result.Response,
+		FromUser:  false,
+		Timestamp: time.Now(),
+	})
+	m.resetResponseChain()
+}
+
+// compare runs /compare: asks several models the same prompt, shows their answers and lets the user adopt one.
+// Canceling ctx stops the requests still running.
+func (m *Manager) compare(ctx context.Context, command string) {
+	models, prompt, err := m.parseCompareArgs(command)
+	if err != nil {
+		m.Println(fmt.Sprintf("Cannot compare: %v", err))
+		m.Println("Usage: /compare <model1,model2,...> <prompt>")
+		return
+	}
+	if !m.hasValidAIConfiguration() {
+		m.Println("No AI configuration found, see /model")
+		return
+	}
+
+	s := spinner.New(spinner.CharSets[26], 100*time.Millisecond)
+	m.showRetries(s)
+	s.Start()
+	currentMessage, results := m.compareModels(ctx, models, prompt)
+	s.Stop()
+
+	if ctx.Err() != nil {
+		m.Println("Comparison canceled.")
+		return
+	}
+
+	m.printComparison(results)
+
+	var choices []string
+	for i, result := range results {
+		if result.Err == nil {
+			choices = append(choices, strconv.Itoa(i+1))
+		}
+	}
+	if len(choices) == 0 {
+		return
+	}
+
+	promptText := color.New(color.FgCyan, color.Bold).Sprintf("\nAdopt an answer into the conversation? [%s] or Enter to skip: ", strings.Join(choices, "/"))
+	input, cancelled, err := readConfirmationInput(promptText)
+	if err != nil || cancelled {
+		return
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return
+	}
+
+	choice, err := strconv.Atoi(input)
+	if err != nil || choice < 1 || choice > len(results) || results[choice-1].Err != nil {
+		m.Println(fmt.Sprintf("Not a valid answer: %s", input))
+		return
+	}
+	m.adoptComparison(currentMessage, results[choice-1])
+	logger.Info("Adopted the answer of model %s", results[choice-1].Model)
+	m.Println(fmt.Sprintf("Adopted the answer of %s.", results[choice-1].Model))
+}
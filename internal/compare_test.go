@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCompareTestManager(t *testing.T) *Manager {
+	fast := writeMockScript(t, "fast.yaml", `responses:
+  - response: "<ExecCommand>df -h</ExecCommand>"
+`)
+	slow := writeMockScript(t, "slow.yaml", `responses:
+  - response: "Check the disk usage first.<WaitingForUserResponse>1</WaitingForUserResponse>"
+    delay: 50ms
+`)
+	manager, _ := newTestClient(t, config.ModelConfig{Provider: "mock", Model: "demo", Script: fast})
+	manager.Config.Models["fast"] = config.ModelConfig{Provider: "mock", Model: "fast", Script: fast}
+	manager.Config.Models["slow"] = config.ModelConfig{Provider: "mock", Model: "slow", Script: slow}
+	manager.getTmuxPanesInXml = func(config *config.Config) string {
+		return "<tmux>mock pane content</tmux>"
+	}
+	return manager
+}
+
+func TestParseCompareArgs(t *testing.T) {
+	manager := newCompareTestManager(t)
+
+	models, prompt, err := manager.parseCompareArgs("/compare fast,slow,fast why is the  disk full?\n  df -h ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fast", "slow"}, models)
+	assert.Equal(t, "why is the  disk full?\n  df -h", prompt, "the prompt is kept as typed")
+
+	_, _, err = manager.parseCompareArgs("/compare fast,unknown prompt")
+	assert.ErrorContains(t, err, "unknown model unknown")
+
+	_, _, err = manager.parseCompareArgs("/compare fast prompt")
+	assert.Error(t, err)
+
+	_, _, err = manager.parseCompareArgs("/compare fast,slow")
+	assert.Error(t, err)
+}
+
+// Test: Each model of a comparison gets its own debug file
+func TestCompareModelsDebugFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	manager := newCompareTestManager(t)
+	manager.Config.Debug = true
+
+	_, results := manager.compareModels(context.Background(), []string{"slow", "fast"}, "why is the disk full?")
+	require.Len(t, results, 2)
+
+	configDir, err := config.GetConfigDir()
+	require.NoError(t, err)
+	files, err := filepath.Glob(filepath.Join(configDir, "debug", "debug-*.txt"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestCompareModels(t *testing.T) {
+	manager := newCompareTestManager(t)
+	manager.Messages = []ChatMessage{{Content: "earlier question", FromUser: true}, {Content: "earlier answer"}}
+
+	currentMessage, results := manager.compareModels(context.Background(), []string{"slow", "fast"}, "why is the disk full?")
+	require.Len(t, results, 2)
+
+	assert.Equal(t, "slow", results[0].Model)
+	require.NoError(t, results[0].Err)
+	assert.True(t, results[0].Parsed.WaitingForUserResponse)
+	assert.GreaterOrEqual(t, results[0].Latency, 50*time.Millisecond)
+	assert.Greater(t, results[0].Usage.InputTokens, 0)
+
+	assert.Equal(t, "fast", results[1].Model)
+	require.NoError(t, results[1].Err)
+	assert.Equal(t, []string{"df -h"}, results[1].Parsed.ExecCommand)
+	assert.Contains(t, compareBody(results[1]), "Would execute: df -h")
+
+	// Comparing leaves the conversation alone until an answer is adopted
+	assert.Len(t, manager.Messages, 2)
+	assert.Empty(t, manager.AnsweringModel)
+	_, last := manager.usageTracker().Last()
+	assert.False(t, last)
+	models, byModel := manager.usageTracker().ByModel()
+	assert.Equal(t, []string{"fast", "slow"}, models)
+	assert.Equal(t, 1, byModel["slow"].Requests)
+
+	assert.Contains(t, currentMessage.Content, "why is the disk full?")
+	manager.adoptComparison(currentMessage, results[1])
+	require.Len(t, manager.Messages, 4)
+	assert.Equal(t, currentMessage, manager.Messages[2])
+	assert.Equal(t, "<ExecCommand>df -h</ExecCommand>", manager.Messages[3].Content)
+}
+
+func TestCompareModelsError(t *testing.T) {
+	manager := newCompareTestManager(t)
+	manager.Config.Models["broken"] = config.ModelConfig{Provider: "mock", Model: "broken", Script: "/nonexistent/script.yaml"}
+
+	_, results := manager.compareModels(context.Background(), []string{"fast", "broken"}, "hello")
+	require.NoError(t, results[0].Err)
+	require.Error(t, results[1].Err)
+
+	var modelErr *ModelError
+	require.ErrorAs(t, results[1].Err, &modelErr)
+	assert.Equal(t, "broken", modelErr.Model)
+}
+
+func TestCompareModelsBudget(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	manager := newCompareTestManager(t)
+	fast, slow := manager.Config.Models["fast"], manager.Config.Models["slow"]
+	fast.InputPrice, slow.InputPrice = 1_000_000, 1_000_000
+	manager.Config.Models["fast"], manager.Config.Models["slow"] = fast, slow
+
+	// There is room for the prompt sent to one model, not to both
+	tokens := 0
+	history, currentMessage := manager.composeHistory("hello")
+	for _, msg := range append(history, currentMessage) {
+		tokens += manager.countTokens(msg.Content)
+	}
+	manager.Config.SessionBudget = float64(tokens) * 1.5
+
+	_, results := manager.compareModels(context.Background(), []string{"fast", "slow"}, "hello")
+	require.NoError(t, results[0].Err)
+	assert.ErrorContains(t, results[1].Err, "session budget")
+	assert.Zero(t, results[1].Usage.Requests, "the model over budget is not asked")
+}
+
+func TestRenderColumns(t *testing.T) {
+	rows := renderColumns([][]string{
+		{"first", "a long line that wraps"},
+		{"second"},
+	}, 10)
+
+	assert.Equal(t, []string{
+		"first      │ second",
+		"a long     │",
+		"line that  │",
+		"wraps      │",
+	}, rows)
+
+	assert.Equal(t, []string{"abcde", "fgh", "ij"}, wrapText("abcdefgh ij", 5))
+}
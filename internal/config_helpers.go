@@ -1,12 +1,15 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
 )
 
 // AllowedConfigKeys defines the list of configuration keys that users are allowed to modify
@@ -14,6 +17,9 @@ var AllowedConfigKeys = []string{
 	"max_capture_lines",
 	"max_context_size",
 	"wait_interval",
+	"max_steps",
+	"max_retries",
+	"max_busy_waits",
 	"send_keys_confirm",
 	"paste_multiline_confirm",
 	"exec_confirm",
@@ -27,6 +33,39 @@ var AllowedConfigKeys = []string{
 	"azure_openai.api_base",
 	"azure_openai.api_version",
 	"default_model",
+	"model_roles.watch",
+	"model_roles.summarize",
+	"model_roles.reflect",
+	"session_budget",
+	"daily_budget",
+}
+
+// ModelOverrideKeys lists the model parameters that can be overridden for the session
+// with /config set models.<name>.<key>
+var ModelOverrideKeys = []string{
+	"temperature",
+	"top_p",
+	"max_tokens",
+	"stop",
+	"reasoning_effort",
+	"reasoning_summary",
+}
+
+// IsModelOverrideKey reports whether key is a per-model override such as models.fast.temperature
+func IsModelOverrideKey(key string) bool {
+	if !strings.HasPrefix(key, "models.") {
+		return false
+	}
+	idx := strings.LastIndex(key, ".")
+	if idx <= len("models.") {
+		return false
+	}
+	for _, k := range ModelOverrideKeys {
+		if key[idx+1:] == k {
+			return true
+		}
+	}
+	return false
 }
 
 // GetMaxCaptureLines returns the max capture lines value with session override if present
@@ -39,14 +78,45 @@ func (m *Manager) GetMaxCaptureLines() int {
 	return m.Config.MaxCaptureLines
 }
 
-// GetMaxContextSize returns the max context size value with session override if present
+// defaultMaxContextSize applies to models of unknown context window when max_context_size is not set
+const defaultMaxContextSize = 100000
+
+// GetMaxContextSize returns the max context size value with session override if present,
+// otherwise the smaller of max_context_size and the context window of the current model
 func (m *Manager) GetMaxContextSize() int {
+	size, _ := m.maxContextSize()
+	return size
+}
+
+// maxContextSize returns the max context size and explains where it comes from, for /info
+func (m *Manager) maxContextSize() (int, string) {
 	if override, exists := m.SessionOverrides["max_context_size"]; exists {
 		if val, ok := override.(int); ok {
-			return val
+			return val, "set for this session"
 		}
 	}
-	return m.Config.MaxContextSize
+	var contextWindow int
+	if modelConfig, exists := m.GetCurrentModelConfig(); exists {
+		contextWindow = modelCapabilities(modelConfig).ContextWindow
+	}
+	configured := m.Config.MaxContextSize
+	switch {
+	case configured > 0 && contextWindow > configured:
+		return configured, fmt.Sprintf("max_context_size, the model allows %d", contextWindow)
+	case contextWindow > 0:
+		return contextWindow, "context window of the model"
+	case configured > 0:
+		return configured, "max_context_size"
+	}
+	return defaultMaxContextSize, "default"
+}
+
+// GetMaxOutput returns the max output tokens of the current model, 0 if unknown
+func (m *Manager) GetMaxOutput() int {
+	if modelConfig, exists := m.GetCurrentModelConfig(); exists {
+		return modelCapabilities(modelConfig).MaxOutput
+	}
+	return 0
 }
 
 // GetWaitInterval returns the wait interval value with session override if present
@@ -59,6 +129,52 @@ func (m *Manager) GetWaitInterval() int {
 	return m.Config.WaitInterval
 }
 
+// Budgets of the agent loop used when the configuration leaves them unset
+const (
+	defaultMaxSteps     = 30
+	defaultMaxRetries   = 3
+	defaultMaxBusyWaits = 60
+)
+
+// GetMaxSteps returns how many steps the agent loop may take for a single request
+func (m *Manager) GetMaxSteps() int {
+	if override, exists := m.SessionOverrides["max_steps"]; exists {
+		if val, ok := override.(int); ok {
+			return val
+		}
+	}
+	if m.Config.MaxSteps <= 0 {
+		return defaultMaxSteps
+	}
+	return m.Config.MaxSteps
+}
+
+// GetMaxRetries returns how many times a request may be retried after the AI did not follow the guidelines
+func (m *Manager) GetMaxRetries() int {
+	if override, exists := m.SessionOverrides["max_retries"]; exists {
+		if val, ok := override.(int); ok {
+			return val
+		}
+	}
+	if m.Config.MaxRetries <= 0 {
+		return defaultMaxRetries
+	}
+	return m.Config.MaxRetries
+}
+
+// GetMaxBusyWaits returns how many times a request may wait for a busy exec pane, each wait is a request to the AI
+func (m *Manager) GetMaxBusyWaits() int {
+	if override, exists := m.SessionOverrides["max_busy_waits"]; exists {
+		if val, ok := override.(int); ok {
+			return val
+		}
+	}
+	if m.Config.MaxBusyWaits <= 0 {
+		return defaultMaxBusyWaits
+	}
+	return m.Config.MaxBusyWaits
+}
+
 func (m *Manager) GetSendKeysConfirm() bool {
 	if override, exists := m.SessionOverrides["send_keys_confirm"]; exists {
 		if val, ok := override.(bool); ok {
@@ -86,6 +202,26 @@ func (m *Manager) GetExecConfirm() bool {
 	return m.Config.ExecConfirm
 }
 
+// GetSessionBudget returns the session budget in USD with session override if present
+func (m *Manager) GetSessionBudget() float64 {
+	if override, exists := m.SessionOverrides["session_budget"]; exists {
+		if val, ok := override.(float64); ok {
+			return val
+		}
+	}
+	return m.Config.SessionBudget
+}
+
+// GetDailyBudget returns the daily budget in USD with session override if present
+func (m *Manager) GetDailyBudget() float64 {
+	if override, exists := m.SessionOverrides["daily_budget"]; exists {
+		if val, ok := override.(float64); ok {
+			return val
+		}
+	}
+	return m.Config.DailyBudget
+}
+
 func (m *Manager) GetOpenRouterModel() string {
 	if override, exists := m.SessionOverrides["openrouter.model"]; exists {
 		if val, ok := override.(string); ok {
@@ -171,8 +307,8 @@ func (m *Manager) GetModelsDefault() string {
 	}
 
 	// If default model is configured, use it
-	if m.Config.DefaultModel != "" {
-		return m.Config.DefaultModel
+	if configured := m.configuredDefaultModel(); configured != "" {
+		return configured
 	}
 
 	// If no default model is set, use the first available model
@@ -185,6 +321,15 @@ func (m *Manager) GetModelsDefault() string {
 	return ""
 }
 
+// configuredDefaultModel returns the chat model set in the configuration file, the chat role
+// taking precedence over default_model
+func (m *Manager) configuredDefaultModel() string {
+	if m.Config.ModelRoles.Chat != "" {
+		return m.Config.ModelRoles.Chat
+	}
+	return m.Config.DefaultModel
+}
+
 // SetModelsDefault sets the default model configuration for the current session
 func (m *Manager) SetModelsDefault(modelName string) {
 	m.SessionOverrides["default_model"] = modelName
@@ -207,12 +352,190 @@ func (m *Manager) GetAvailableModels() []string {
 	return models
 }
 
-// GetModelConfig returns the model configuration for the given name
+// GetModelConfig returns the model configuration for the given name.
+// Configured models take precedence over local models discovered through Ollama.
 func (m *Manager) GetModelConfig(name string) (config.ModelConfig, bool) {
 	config, exists := m.Config.Models[name]
+	if !exists {
+		config, exists = m.OllamaModels[name]
+	}
+	if exists {
+		config = m.applyModelOverrides(name, config)
+	}
 	return config, exists
 }
 
+// applyModelOverrides applies the session overrides set with /config set models.<name>.<key>
+func (m *Manager) applyModelOverrides(name string, modelConfig config.ModelConfig) config.ModelConfig {
+	prefix := "models." + name + "."
+	for _, key := range ModelOverrideKeys {
+		override, exists := m.SessionOverrides[prefix+key]
+		if !exists {
+			continue
+		}
+		switch key {
+		case "temperature":
+			if val, ok := override.(float64); ok {
+				modelConfig.Temperature = &val
+			}
+		case "top_p":
+			if val, ok := override.(float64); ok {
+				modelConfig.TopP = &val
+			}
+		case "max_tokens":
+			if val, ok := override.(int); ok {
+				modelConfig.MaxTokens = val
+			}
+		case "stop":
+			if val, ok := override.(string); ok {
+				modelConfig.Stop = nil
+				for _, stop := range strings.Split(val, ",") {
+					if stop = strings.TrimSpace(stop); stop != "" {
+						modelConfig.Stop = append(modelConfig.Stop, stop)
+					}
+				}
+			}
+		case "reasoning_effort":
+			if val, ok := override.(string); ok {
+				modelConfig.ReasoningEffort = val
+			}
+		case "reasoning_summary":
+			if val, ok := override.(string); ok {
+				modelConfig.ReasoningSummary = val
+			}
+		}
+	}
+	return modelConfig
+}
+
+// GetFallbackModels returns the configured fallback chain without the current model and unknown names
+func (m *Manager) GetFallbackModels() []string {
+	current := m.GetModelsDefault()
+	var models []string
+	for _, name := range m.Config.FallbackModels {
+		if name == current {
+			continue
+		}
+		if _, exists := m.GetModelConfig(name); !exists {
+			logger.Debug("Ignoring unknown fallback model: %s", name)
+			continue
+		}
+		models = append(models, name)
+	}
+	return models
+}
+
+// Roles a model can be given with model_roles
+const (
+	RoleChat      = "chat"
+	RoleWatch     = "watch"
+	RoleSummarize = "summarize"
+	RoleReflect   = "reflect"
+)
+
+// ModelRoleNames lists the roles in the order they are shown
+var ModelRoleNames = []string{RoleChat, RoleWatch, RoleSummarize, RoleReflect}
+
+// GetRoleModel returns the name of the model doing the work of a role.
+// Roles without a model of their own, or with an unknown one, use the current chat model.
+func (m *Manager) GetRoleModel(role string) string {
+	current := m.GetModelsDefault()
+	if role == "" || role == RoleChat {
+		return current
+	}
+
+	var name string
+	if override, exists := m.SessionOverrides["model_roles."+role]; exists {
+		name, _ = override.(string)
+	} else {
+		switch role {
+		case RoleWatch:
+			name = m.Config.ModelRoles.Watch
+		case RoleSummarize:
+			name = m.Config.ModelRoles.Summarize
+		case RoleReflect:
+			name = m.Config.ModelRoles.Reflect
+		}
+	}
+	if name == "" {
+		return current
+	}
+	if _, exists := m.GetModelConfig(name); !exists {
+		logger.Debug("Ignoring unknown %s model: %s", role, name)
+		return current
+	}
+	return name
+}
+
+// useNativeTools reports whether the current model requests actions through native tool calls
+func (m *Manager) useNativeTools() bool {
+	modelConfig, exists := m.GetCurrentModelConfig()
+	return exists && modelConfig.ToolCalling == "native"
+}
+
+// GetOllamaModels returns the names of discovered local Ollama models that are not shadowed by a configured model
+func (m *Manager) GetOllamaModels() []string {
+	var models []string
+	for name := range m.OllamaModels {
+		if _, configured := m.Config.Models[name]; !configured {
+			models = append(models, name)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// discoverOllamaModels asks every configured Ollama server, or the default local one
+// when none is configured, for its models and remembers them for this session.
+// Discovered models connect the way the configured model of their server does.
+func (m *Manager) discoverOllamaModels(ctx context.Context) {
+	client, ok := m.AiClient.(*AiClient)
+	if !ok {
+		client = NewAiClient(m.Config)
+	}
+
+	baseURLs := map[string]config.ModelConfig{}
+	for _, name := range m.GetAvailableModels() {
+		modelConfig := m.Config.Models[name]
+		if modelConfig.Provider == "ollama" {
+			baseURLs[ollamaBaseURL(modelConfig.BaseURL)] = modelConfig
+		}
+	}
+	if len(baseURLs) == 0 {
+		baseURLs[ollamaDefaultBaseURL] = config.ModelConfig{Provider: "ollama"}
+	}
+
+	discovered := make(map[string]config.ModelConfig)
+	for baseURL, template := range baseURLs {
+		names, err := client.fetchOllamaModels(ctx, template)
+		if ctx.Err() != nil {
+			// Canceled, keep what an earlier discovery found
+			return
+		}
+		if err != nil {
+			logger.Debug("Failed to list Ollama models from %s: %v", baseURL, err)
+			continue
+		}
+		for _, name := range names {
+			discovered[name] = config.ModelConfig{
+				Provider:        "ollama",
+				Model:           name,
+				BaseURL:         baseURL,
+				KeepAlive:       template.KeepAlive,
+				NumCtx:          template.NumCtx,
+				Headers:         template.Headers,
+				Proxy:           template.Proxy,
+				CACert:          template.CACert,
+				ClientCert:      template.ClientCert,
+				ClientKey:       template.ClientKey,
+				ConnectTimeout:  template.ConnectTimeout,
+				ResponseTimeout: template.ResponseTimeout,
+			}
+		}
+	}
+	m.OllamaModels = discovered
+}
+
 // GetCurrentModelConfig returns the currently active model configuration
 func (m *Manager) GetCurrentModelConfig() (config.ModelConfig, bool) {
 	// First try to get the model from the new models system
@@ -235,16 +558,17 @@ func (m *Manager) hasValidAIConfiguration() bool {
 		// Check if any model has an API key
 		for _, modelName := range availableModels {
 			if modelConfig, exists := m.GetModelConfig(modelName); exists {
-				if modelConfig.APIKey != "" {
+				if modelConfig.HasAPIKey() || modelConfig.Provider == "ollama" || modelConfig.Provider == "mock" {
 					return true
 				}
 			}
 		}
-		// Also check if current model has API key
-		if currentModelConfig, exists := m.GetCurrentModelConfig(); exists {
-			if currentModelConfig.APIKey != "" {
-				return true
-			}
+	}
+
+	// Also check if current model has API key, which may be a discovered local model
+	if currentModelConfig, exists := m.GetCurrentModelConfig(); exists {
+		if currentModelConfig.HasAPIKey() || currentModelConfig.Provider == "ollama" || currentModelConfig.Provider == "mock" {
+			return true
 		}
 	}
 
@@ -54,65 +54,13 @@ func (m *Manager) confirmedToExecFn(command string, prompt string, edit bool) (b
 	case "y", "yes", "ok", "sure":
 		return true, command
 	case "e", "edit":
-		// Use external editor (Git-like approach)
-		editor := os.Getenv("EDITOR")
-		if editor == "" {
-			editor = os.Getenv("VISUAL")
-		}
-		if editor == "" {
-			// Fall back to common editors
-			editors := []string{"vim", "vi", "nano", "emacs"}
-			for _, e := range editors {
-				if _, err := exec.LookPath(e); err == nil {
-					editor = e
-					break
-				}
-			}
-		}
-
-		if editor == "" {
-			fmt.Println("Error: No editor found. Please set the EDITOR environment variable.")
-			return false, ""
-		}
-
-		// Create a temporary file for editing
-		tmpFile, err := os.CreateTemp("", "tmuxai-edit-*.sh")
-		if err != nil {
-			fmt.Printf("Error creating temporary file: %v\n", err)
-			return false, ""
-		}
-		defer func() { _ = os.Remove(tmpFile.Name()) }()
-
-		// Write the command to the temporary file
-		if _, err := tmpFile.WriteString(command); err != nil {
-			fmt.Printf("Error writing to temporary file: %v\n", err)
-			_ = tmpFile.Close()
-			return false, ""
-		}
-		if err := tmpFile.Close(); err != nil {
-			fmt.Printf("Error closing temporary file: %v\n", err)
-			return false, ""
-		}
-
-		// Open the editor
-		cmd := exec.Command(editor, tmpFile.Name())
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("Error running editor: %v\n", err)
-			return false, ""
-		}
-
-		// Read the edited command
-		editedBytes, err := os.ReadFile(tmpFile.Name())
+		editedCommand, err := editInEditor(command, "tmuxai-edit-*.sh")
 		if err != nil {
-			fmt.Printf("Error reading edited command: %v\n", err)
+			fmt.Printf("Error: %v\n", err)
 			return false, ""
 		}
 
-		editedCommand := strings.TrimSpace(string(editedBytes))
+		editedCommand = strings.TrimSpace(editedCommand)
 		if editedCommand != "" {
 			return true, editedCommand
 		} else {
@@ -127,6 +75,60 @@ func (m *Manager) confirmedToExecFn(command string, prompt string, edit bool) (b
 	}
 }
 
+// editInEditor opens content in the user's editor (Git-like approach) and returns it as saved.
+// The temporary file is named after pattern, so editors can pick the right syntax.
+func editInEditor(content string, pattern string) (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = os.Getenv("VISUAL")
+	}
+	if editor == "" {
+		// Fall back to common editors
+		editors := []string{"vim", "vi", "nano", "emacs"}
+		for _, e := range editors {
+			if _, err := exec.LookPath(e); err == nil {
+				editor = e
+				break
+			}
+		}
+	}
+
+	if editor == "" {
+		return "", fmt.Errorf("no editor found, please set the EDITOR environment variable")
+	}
+
+	// Create a temporary file for editing
+	tmpFile, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+
+	if _, err := tmpFile.WriteString(content); err != nil {
+		_ = tmpFile.Close()
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	// Open the editor
+	cmd := exec.Command(editor, tmpFile.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run editor: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read edited file: %w", err)
+	}
+	return string(edited), nil
+}
+
 func (m *Manager) whitelistCheck(command string) (bool, error) {
 	isWhitelisted := false
 	for _, pattern := range m.Config.WhitelistPatterns {
@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dryRunTags names the actions of a step the way the AI asked for them
+var dryRunTags = map[string]string{
+	"exec":      "ExecCommand",
+	"send_keys": "TmuxSendKeys",
+	"paste":     "PasteMultilineContent",
+}
+
+// dryRunObservation is sent back to the AI in place of updated pane contents after a dry run skipped its actions,
+// so it can go on with the rest of the request as if they had run
+func dryRunObservation(actions []StepAction) string {
+	var builder strings.Builder
+	builder.WriteString("This is a dry run, nothing was sent to the panes and their content did not change.\n")
+	for _, action := range actions {
+		if action.DryRun {
+			var attributes string
+			if action.Pane != "" {
+				attributes = fmt.Sprintf(` pane="%s"`, action.Pane)
+			}
+			builder.WriteString(fmt.Sprintf("<%s%s>%s</%s>: not executed (dry run)\n", dryRunTags[action.Kind], attributes, action.Content, dryRunTags[action.Kind]))
+		}
+	}
+	builder.WriteString("Continue with the next steps as if these actions had succeeded, until the request would be accomplished.")
+	return builder.String()
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -90,6 +91,30 @@ func (m *Manager) ExecWaitCapture(command string) (CommandExecHistory, error) {
 	return cmd, nil
 }
 
+// execInPane runs an approved command in a pane, the exec pane when pane is empty, and tells the post_exec hook about it.
+// When it runs in the prepared exec pane it waits for the command to finish and returns its captured result.
+func (m *Manager) execInPane(ctx context.Context, request string, pane string, command string) (CommandExecHistory, error) {
+	target := m.targetPane(pane)
+	event := HookEvent{Event: HookPostExec, Request: request, Command: command, Pane: target}
+	if target != m.ExecPane.Id || !m.ExecPane.IsPrepared {
+		_ = system.TmuxSendCommandToPane(target, command, true)
+		time.Sleep(1 * time.Second)
+		m.notifyHook(ctx, event)
+		return CommandExecHistory{Command: command}, nil
+	}
+
+	history, err := m.ExecWaitCapture(command)
+	if err != nil {
+		logger.Warn("ExecWaitCapture failed for command '%s': %v", command, err)
+		m.notifyHook(ctx, event)
+		return CommandExecHistory{Command: command}, err
+	}
+	m.enqueueReflection(history)
+	event.Result = &history
+	m.notifyHook(ctx, event)
+	return history, nil
+}
+
 func (m *Manager) parseExecPaneCommandHistory() {
 	m.parseExecPaneCommandHistoryWithContent("")
 }
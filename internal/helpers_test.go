@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// newTestClient returns a manager whose only model configuration, "main", is modelConfig,
+// and the AI client of the manager, set up the way NewManager does
+func newTestClient(t *testing.T, modelConfig config.ModelConfig) (*Manager, *AiClient) {
+	t.Helper()
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "main",
+			Models:       map[string]config.ModelConfig{"main": modelConfig},
+		},
+		SessionOverrides: make(map[string]interface{}),
+		CurrentPersona:   "default",
+		Status:           "running",
+		ExecPane:         &system.TmuxPaneDetails{},
+	}
+	client := NewAiClient(manager.Config)
+	client.SetConfigManager(manager)
+	manager.AiClient = client
+	return manager, client
+}
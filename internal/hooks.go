@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// hookTimeout bounds how long a hook may run before it is killed
+const hookTimeout = 30 * time.Second
+
+// Hook events, named like their keys in the hooks configuration
+const (
+	HookPreExec               = "pre_exec"
+	HookPostExec              = "post_exec"
+	HookPreSendKeys           = "pre_send_keys"
+	HookOnResponse            = "on_response"
+	HookOnRequestAccomplished = "on_request_accomplished"
+	HookOnError               = "on_error"
+)
+
+// HookEvent is what a hook gets as JSON on stdin, fields that do not apply to the event are left out
+type HookEvent struct {
+	Event    string              `json:"event"`
+	Request  string              `json:"request,omitempty"`  // the user's request
+	Command  string              `json:"command,omitempty"`  // pre_exec and post_exec
+	Keys     []string            `json:"keys,omitempty"`     // pre_send_keys
+	Pane     string              `json:"pane,omitempty"`     // pane the action is sent to
+	Result   *CommandExecHistory `json:"result,omitempty"`   // post_exec, when the exec pane is prepared
+	Response string              `json:"response,omitempty"` // on_response and on_request_accomplished
+	Model    string              `json:"model,omitempty"`    // model that answered
+	Steps    int                 `json:"steps,omitempty"`    // on_request_accomplished and on_error
+	Error    string              `json:"error,omitempty"`    // on_error
+	DryRun   bool                `json:"dry_run,omitempty"`
+}
+
+// hookCommand returns the configured command of a hook event, empty when there is none
+func (m *Manager) hookCommand(event string) string {
+	hooks := m.Config.Hooks
+	switch event {
+	case HookPreExec:
+		return hooks.PreExec
+	case HookPostExec:
+		return hooks.PostExec
+	case HookPreSendKeys:
+		return hooks.PreSendKeys
+	case HookOnResponse:
+		return hooks.OnResponse
+	case HookOnRequestAccomplished:
+		return hooks.OnRequestAccomplished
+	case HookOnError:
+		return hooks.OnError
+	}
+	return ""
+}
+
+// hookReply is what a pre hook prints on stdout to rewrite the action, anything else it prints is ignored
+type hookReply struct {
+	Command *string  `json:"command"` // pre_exec
+	Keys    []string `json:"keys"`    // pre_send_keys
+}
+
+// runHook runs the hook of an event with the event as JSON on stdin and returns what it printed.
+// Nothing is run when the event has no hook configured, the hook is killed when ctx is canceled.
+func (m *Manager) runHook(ctx context.Context, event HookEvent) (string, error) {
+	command := m.hookCommand(event.Event)
+	if command == "" {
+		return "", nil
+	}
+	event.DryRun = m.DryRun
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s event: %w", event.Event, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = os.Stderr
+	// children of the shell may keep its output open after it was killed
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if err != nil {
+		logger.Warn("%s hook '%s' failed: %v", event.Event, command, err)
+		return "", fmt.Errorf("%s hook failed: %w", event.Event, err)
+	}
+	logger.Debug("%s hook '%s' ran", event.Event, command)
+	return strings.TrimSpace(string(out)), nil
+}
+
+// notifyHook runs a hook that only observes, its failures are logged and otherwise ignored
+func (m *Manager) notifyHook(ctx context.Context, event HookEvent) {
+	_, _ = m.runHook(ctx, event)
+}
+
+// parseHookReply reads the rewrite a pre hook asked for, nil when its output is not a hook reply
+func parseHookReply(event string, out string) *hookReply {
+	if !strings.HasPrefix(out, "{") {
+		if out != "" {
+			logger.Debug("%s hook output is not a JSON reply, ignoring it", event)
+		}
+		return nil
+	}
+	var reply hookReply
+	if err := json.Unmarshal([]byte(out), &reply); err != nil {
+		logger.Warn("%s hook printed an invalid reply, ignoring it: %v", event, err)
+		return nil
+	}
+	return &reply
+}
+
+// preExecHook lets the pre_exec hook veto a command for a pane, or rewrite it by printing {"command": "..."}.
+// It returns the command to go on with, false when it was vetoed.
+func (m *Manager) preExecHook(ctx context.Context, request string, pane string, command string) (string, bool) {
+	out, err := m.runHook(ctx, HookEvent{Event: HookPreExec, Request: request, Command: command, Pane: pane})
+	if err != nil {
+		m.Println("Blocked by the pre_exec hook: " + command)
+		return "", false
+	}
+	reply := parseHookReply(HookPreExec, out)
+	if reply != nil && reply.Command != nil && strings.TrimSpace(*reply.Command) != "" && *reply.Command != command {
+		logger.Info("pre_exec hook rewrote '%s' to '%s'", command, *reply.Command)
+		return *reply.Command, true
+	}
+	return command, true
+}
+
+// preSendKeysHook lets the pre_send_keys hook veto keys for a pane, or rewrite them by printing {"keys": [...]}.
+// It returns the keys to go on with, false when they were vetoed.
+func (m *Manager) preSendKeysHook(ctx context.Context, request string, pane string, keys []string) ([]string, bool) {
+	out, err := m.runHook(ctx, HookEvent{Event: HookPreSendKeys, Request: request, Keys: keys, Pane: pane})
+	if err != nil {
+		m.Println("Blocked by the pre_send_keys hook.")
+		return nil, false
+	}
+	reply := parseHookReply(HookPreSendKeys, out)
+	if reply == nil || len(reply.Keys) == 0 {
+		return keys, true
+	}
+	logger.Info("pre_send_keys hook rewrote the keys to send")
+	return reply.Keys, true
+}
+
+// finishHooks tells the hooks how a request ended: accomplished, or stopped by an error
+func (m *Manager) finishHooks(ctx context.Context, request string, step AgentStep) {
+	switch {
+	case step.Outcome == StepAccomplished:
+		m.notifyHook(ctx, HookEvent{Event: HookOnRequestAccomplished, Request: request, Response: step.Response.Message, Model: step.Model, Steps: step.Number})
+	case step.Err != nil && step.Outcome != StepCanceled:
+		m.notifyHook(ctx, HookEvent{Event: HookOnError, Request: request, Model: step.Model, Steps: step.Number, Error: step.Err.Error()})
+	}
+}
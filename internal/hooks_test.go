@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// readHookEvents reads the events a hook appended to a file, one per line
+func readHookEvents(t *testing.T, path string) []HookEvent {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var events []HookEvent
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event HookEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+	return events
+}
+
+// captureSent records what is sent to the panes instead of sending it
+func captureSent(t *testing.T) *[]string {
+	var sent []string
+	originalSend := system.TmuxSendCommandToPane
+	t.Cleanup(func() { system.TmuxSendCommandToPane = originalSend })
+	system.TmuxSendCommandToPane = func(paneId string, command string, enter bool) error {
+		sent = append(sent, command)
+		return nil
+	}
+	return &sent
+}
+
+func TestRunHook(t *testing.T) {
+	dir := t.TempDir()
+	manager := &Manager{Config: &config.Config{Hooks: config.HooksConfig{
+		PreExec: "cat > " + filepath.Join(dir, "event.json") + "; echo '  {\"command\": \"ls -la\"}  '",
+		OnError: "echo failing >&2; exit 3",
+	}}, ExecPane: &system.TmuxPaneDetails{Id: "%2"}}
+
+	out, err := manager.runHook(context.Background(), HookEvent{Event: HookPreExec, Command: "ls"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"command": "ls -la"}`, out)
+	events := readHookEvents(t, filepath.Join(dir, "event.json"))
+	assert.Equal(t, []HookEvent{{Event: HookPreExec, Command: "ls"}}, events)
+
+	_, err = manager.runHook(context.Background(), HookEvent{Event: HookOnError, Error: "boom"})
+	assert.ErrorContains(t, err, "on_error hook failed")
+
+	// Events without a hook run nothing
+	out, err = manager.runHook(context.Background(), HookEvent{Event: HookPostExec})
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+// Test: The pre_exec hook rewrites the command before it is confirmed, the other hooks observe the request
+func TestProcessUserMessage_Hooks(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "events.jsonl")
+	appendEvent := "cat >> " + log + "; echo >> " + log
+	manager, _ := newLoopTestManager("<ExecCommand>df -h</ExecCommand>", "<RequestAccomplished>1</RequestAccomplished>")
+	manager.Config.Hooks = config.HooksConfig{
+		PreExec:               appendEvent + "; echo '{\"command\": \"df -h /\"}'",
+		PostExec:              appendEvent,
+		OnResponse:            appendEvent,
+		OnRequestAccomplished: appendEvent,
+	}
+	manager.ExecPane.Id = "%1"
+	manager.Config.ExecConfirm = true
+	var confirmed string
+	manager.confirmedToExec = func(command string, prompt string, edit bool) (bool, string) {
+		confirmed = command
+		return true, command
+	}
+	sent := captureSent(t)
+
+	assert.True(t, manager.ProcessUserMessage(context.Background(), "is the disk full?"))
+	assert.Equal(t, "df -h /", confirmed)
+	assert.Equal(t, []string{"df -h /"}, *sent)
+
+	events := readHookEvents(t, log)
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.Event
+		assert.Equal(t, "is the disk full?", event.Request)
+	}
+	assert.Equal(t, []string{HookOnResponse, HookPreExec, HookPostExec, HookOnResponse, HookOnRequestAccomplished}, names)
+	assert.Equal(t, "<ExecCommand>df -h</ExecCommand>", events[0].Response)
+	assert.Equal(t, "df -h", events[1].Command)
+	assert.Equal(t, "%1", events[1].Pane)
+	assert.Equal(t, "df -h /", events[2].Command)
+	assert.Nil(t, events[2].Result, "the unprepared exec pane has no captured result")
+	assert.Equal(t, 2, events[4].Steps)
+}
+
+// Test: Pre hooks exiting non-zero veto the action
+func TestProcessUserMessage_HookVeto(t *testing.T) {
+	manager, _ := newLoopTestManager("<ExecCommand>rm -rf /</ExecCommand>")
+	manager.Config.Hooks.PreExec = "grep -q 'rm -rf' && exit 1; exit 0"
+	manager.confirmedToExec = func(command string, prompt string, edit bool) (bool, string) {
+		t.Errorf("a vetoed command should not be confirmed, asked for %q", command)
+		return false, ""
+	}
+	sent := captureSent(t)
+
+	assert.False(t, manager.ProcessUserMessage(context.Background(), "clean up"))
+	assert.Empty(t, *sent)
+	require.Len(t, manager.Trace, 1)
+	assert.Equal(t, StepVetoed, manager.Trace[0].Outcome)
+	assert.Equal(t, []StepAction{{Kind: "exec", Content: "rm -rf /"}}, manager.Trace[0].Actions)
+
+	// Keys are rewritten by a JSON reply
+	manager, _ = newLoopTestManager("<TmuxSendKeys>:wq</TmuxSendKeys>", "<RequestAccomplished>1</RequestAccomplished>")
+	manager.Config.Hooks.PreSendKeys = `echo '{"keys": ["Escape", ":wq"]}'`
+	sent = captureSent(t)
+
+	assert.True(t, manager.ProcessUserMessage(context.Background(), "save the file"))
+	assert.Equal(t, []string{"Escape", ":wq"}, *sent)
+}
+
+// Test: The on_error hook is told why a request failed
+func TestProcessUserMessage_ErrorHook(t *testing.T) {
+	dir := t.TempDir()
+	mockAiClient := &MockAiClient{}
+	mockAiClient.On("GetResponseFromChatMessages", mock.Anything, mock.Anything, mock.Anything).Return("", errors.New("connection refused"))
+	manager, _ := newLoopTestManager()
+	manager.AiClient = mockAiClient
+	manager.Config.Hooks.OnError = "cat > " + filepath.Join(dir, "error.json")
+
+	assert.False(t, manager.ProcessUserMessage(context.Background(), "hello"))
+	events := readHookEvents(t, filepath.Join(dir, "error.json"))
+	require.Len(t, events, 1)
+	assert.Equal(t, HookOnError, events[0].Event)
+	assert.Equal(t, "hello", events[0].Request)
+	assert.Equal(t, "connection refused", events[0].Error)
+}
+
+// Test: Pre hooks that only observe don't rewrite the action, even when they echo the event back
+func TestPreHooksRewriteOnlyOnReply(t *testing.T) {
+	manager := &Manager{Config: &config.Config{Hooks: config.HooksConfig{
+		PreExec:     "cat",
+		PreSendKeys: "echo logged",
+	}}}
+	ctx := context.Background()
+
+	command, allowed := manager.preExecHook(ctx, "clean up", "%2", "ls")
+	assert.True(t, allowed)
+	assert.Equal(t, "ls", command)
+
+	keys, allowed := manager.preSendKeysHook(ctx, "save", "%2", []string{":wq", "Enter"})
+	assert.True(t, allowed)
+	assert.Equal(t, []string{":wq", "Enter"}, keys)
+
+	manager.Config.Hooks.PreExec = `echo '{"command": "ls -la"}'`
+	command, allowed = manager.preExecHook(ctx, "clean up", "%2", "ls")
+	assert.True(t, allowed)
+	assert.Equal(t, "ls -la", command)
+}
+
+// Test: Canceling the request stops a hung hook
+func TestRunHook_Canceled(t *testing.T) {
+	manager := &Manager{Config: &config.Config{Hooks: config.HooksConfig{PreExec: "sleep 10"}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, allowed := manager.preExecHook(ctx, "clean up", "%2", "ls")
+	assert.False(t, allowed, "a hook that didn't finish doesn't approve the command")
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
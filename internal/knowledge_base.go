@@ -8,7 +8,6 @@ import (
 
 	"github.com/alvinunreal/tmuxai/config"
 	"github.com/alvinunreal/tmuxai/logger"
-	"github.com/alvinunreal/tmuxai/system"
 )
 
 // loadKB loads a knowledge base file by name
@@ -101,7 +100,7 @@ func (m *Manager) LoadKBsFromCLI(kbNames []string) {
 func (m *Manager) getTotalLoadedKBTokens() int {
 	total := 0
 	for _, content := range m.LoadedKBs {
-		total += system.EstimateTokenCount(content)
+		total += m.countTokens(content)
 	}
 	return total
 }
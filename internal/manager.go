@@ -7,6 +7,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/alvinunreal/tmuxai/config"
@@ -22,6 +23,8 @@ type AIResponse struct {
 	SendKeys               []string
 	ExecCommand            []string
 	PasteMultilineContent  string
+	Pane                   string // pane="%N" of the action tags, empty for the exec pane
+	PaneConflict           string // set when the actions target different panes, see aiFollowedGuidelines
 	RequestAccomplished    bool
 	ExecPaneSeemsBusy      bool
 	WaitingForUserResponse bool
@@ -36,9 +39,9 @@ type AiClientInterface interface {
 
 // Parsed only when pane is prepared
 type CommandExecHistory struct {
-	Command string
-	Output  string
-	Code    int
+	Command string `json:"command"`
+	Output  string `json:"output"`
+	Code    int    `json:"code"`
 }
 
 type CommandReflection struct {
@@ -79,12 +82,21 @@ type Manager struct {
 	WatchMode          bool
 	OS                 string
 	CurrentPersona     string
-	SessionOverrides   map[string]interface{} // session-only config overrides
-	LoadedKBs          map[string]string      // Loaded knowledge bases (name -> content)
+	SessionOverrides   map[string]interface{}        // session-only config overrides
+	LoadedKBs          map[string]string             // Loaded knowledge bases (name -> content)
+	OllamaModels       map[string]config.ModelConfig // Local models discovered through Ollama's /api/tags
+	AnsweringModel     string                        // Model configuration that produced the last response
+	Usage              *UsageTracker                 // Token usage reported by the providers this session
+	ResponseChain      *responseChain                // Last response stored by the Responses API, nil resends everything
+	Trace              []AgentStep                   // Steps of the agent loop for the last request
+	DryRun             bool                          // Actions are shown but never sent to the panes
+	AllowedPanes       map[string]bool               // Session overrides of writable_panes by pane id, see /pane
+	retryState         atomic.Value                  // Retry of the request in progress shown in the prompt, see doWithRetry
 
 	// Functions for mocking
 	confirmedToExec   func(command string, prompt string, edit bool) (bool, string)
 	getTmuxPanesInXml func(config *config.Config) string
+	reviewPlan        func(plan Plan) (Plan, bool)
 }
 
 // NewManager creates a new manager agent
@@ -122,6 +134,7 @@ func NewManager(cfg *config.Config) (*Manager, error) {
 		OS:               os,
 		SessionOverrides: make(map[string]interface{}),
 		LoadedKBs:        make(map[string]string),
+		Usage:            NewUsageTracker(),
 	}
 
 	// Set the config manager in the AI client
@@ -129,10 +142,12 @@ func NewManager(cfg *config.Config) (*Manager, error) {
 
 	manager.confirmedToExec = manager.confirmedToExecFn
 	manager.getTmuxPanesInXml = manager.getTmuxPanesInXmlFn
+	manager.reviewPlan = manager.reviewPlanFn
 
 	manager.CurrentPersona = manager.selectPersona()
 	logger.Debug("Selected persona: %s", manager.CurrentPersona)
 	manager.InitExecPane()
+	manager.checkWritablePanes()
 	manager.loadReflectionLog()
 
 	// Auto-load knowledge bases from config
@@ -254,13 +269,12 @@ Return only JSON with no code fences.`
 		return CommandReflection{}, err
 	}
 
-	messages := []Message{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: string(userBytes)},
+	messages := []ChatMessage{
+		{Content: systemPrompt, FromUser: false, Timestamp: time.Now()},
+		{Content: string(userBytes), FromUser: true, Timestamp: time.Now()},
 	}
 
-	model := m.GetOpenRouterModel()
-	resp, err := m.AiClient.ChatCompletion(ctx, messages, model)
+	resp, err := m.AiClient.GetResponseFromChatMessages(withModelRole(ctx, RoleReflect), messages, m.GetModel())
 	if err != nil {
 		return CommandReflection{}, err
 	}
@@ -484,9 +498,16 @@ func (m *Manager) GetPrompt() string {
 	// Show current model if it's not the default or first available model
 	currentModel := m.GetModelsDefault()
 	availableModels := m.GetAvailableModels()
-	if len(availableModels) > 0 {
+	routedModel := currentModel
+	if m.WatchMode {
+		routedModel = m.GetRoleModel(RoleWatch)
+	}
+	if m.AnsweringModel != "" && routedModel != "" && m.AnsweringModel != routedModel {
+		// The last response came from a fallback model
+		prompt += " " + modelColor.Sprint("["+m.AnsweringModel+" (fallback)]")
+	} else if len(availableModels) > 0 {
 		// Get the "expected" model (configured default or first available)
-		expectedModel := m.Config.DefaultModel
+		expectedModel := m.configuredDefaultModel()
 		if expectedModel == "" && len(availableModels) > 0 {
 			expectedModel = availableModels[0] // First model as default
 		}
@@ -500,6 +521,12 @@ func (m *Manager) GetPrompt() string {
 	if stateSymbol != "" {
 		prompt += " " + stateColor.Sprint("["+stateSymbol+"]")
 	}
+	if retry := m.RetryState(); retry != "" {
+		prompt += " " + stateColor.Sprint("["+retry+"]")
+	}
+	if m.DryRun {
+		prompt += " " + arrowColor.Sprint("[dry run]")
+	}
 	prompt += arrowColor.Sprint(" » ")
 	return prompt
 }
@@ -510,6 +537,8 @@ func (ai *AIResponse) String() string {
 	SendKeys: %v
 	ExecCommand: %v
 	PasteMultilineContent: %s
+	Pane: %s
+	PaneConflict: %s
 	RequestAccomplished: %v
 	ExecPaneSeemsBusy: %v
 	WaitingForUserResponse: %v
@@ -519,6 +548,8 @@ func (ai *AIResponse) String() string {
 		ai.SendKeys,
 		ai.ExecCommand,
 		ai.PasteMultilineContent,
+		ai.Pane,
+		ai.PaneConflict,
 		ai.RequestAccomplished,
 		ai.ExecPaneSeemsBusy,
 		ai.WaitingForUserResponse,
@@ -10,11 +10,11 @@ import (
 
 func TestModelConfiguration(t *testing.T) {
 	tests := []struct {
-		name           string
-		config         *config.Config
-		expectedModel  string
-		expectedValid  bool
-		expectedCount  int
+		name          string
+		config        *config.Config
+		expectedModel string
+		expectedValid bool
+		expectedCount int
 	}{
 		{
 			name: "multiple models with default",
@@ -179,8 +179,8 @@ func TestModelConfigurationWithSessionOverrides(t *testing.T) {
 
 func TestGetModel(t *testing.T) {
 	tests := []struct {
-		name           string
-		config         *config.Config
+		name          string
+		config        *config.Config
 		expectedModel string
 	}{
 		{
@@ -258,10 +258,10 @@ func TestGetModel(t *testing.T) {
 
 func TestLegacyModelConfig(t *testing.T) {
 	tests := []struct {
-		name           string
-		config         *config.Config
+		name             string
+		config           *config.Config
 		expectedProvider string
-		expectedModel   string
+		expectedModel    string
 	}{
 		{
 			name: "openai priority",
@@ -276,7 +276,7 @@ func TestLegacyModelConfig(t *testing.T) {
 				},
 			},
 			expectedProvider: "openai",
-			expectedModel:   "gpt-4",
+			expectedModel:    "gpt-4",
 		},
 		{
 			name: "azure priority over openrouter",
@@ -291,7 +291,7 @@ func TestLegacyModelConfig(t *testing.T) {
 				},
 			},
 			expectedProvider: "azure",
-			expectedModel:   "gpt-4o",
+			expectedModel:    "gpt-4o",
 		},
 		{
 			name: "openrouter fallback",
@@ -302,7 +302,7 @@ func TestLegacyModelConfig(t *testing.T) {
 				},
 			},
 			expectedProvider: "openrouter",
-			expectedModel:   "gemini-flash",
+			expectedModel:    "gemini-flash",
 		},
 	}
 
@@ -324,4 +324,41 @@ func TestLegacyModelConfig(t *testing.T) {
 			assert.Equal(t, tt.expectedModel, modelConfig.Model)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestModelParameterOverrides(t *testing.T) {
+	temperature := 0.7
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "fast",
+			Models: map[string]config.ModelConfig{
+				"fast": {Provider: "openrouter", Model: "fast-model", Temperature: &temperature, MaxTokens: 1000},
+			},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+
+	assert.True(t, IsModelOverrideKey("models.fast.temperature"))
+	assert.False(t, IsModelOverrideKey("models.fast.api_key"))
+	assert.False(t, IsModelOverrideKey("models.temperature"))
+
+	for key, value := range map[string]string{
+		"models.fast.temperature":      "0.2",
+		"models.fast.max_tokens":       "256",
+		"models.fast.stop":             "</done>, END",
+		"models.fast.reasoning_effort": "high",
+	} {
+		manager.SessionOverrides[key] = config.TryInferType(key, value)
+	}
+
+	modelConfig, exists := manager.GetCurrentModelConfig()
+	require.True(t, exists)
+	require.NotNil(t, modelConfig.Temperature)
+	assert.Equal(t, 0.2, *modelConfig.Temperature)
+	assert.Equal(t, 256, modelConfig.MaxTokens)
+	assert.Equal(t, []string{"</done>", "END"}, modelConfig.Stop)
+	assert.Equal(t, "high", modelConfig.ReasoningEffort)
+
+	// The configured value itself is left untouched
+	assert.Equal(t, 0.7, temperature)
+}
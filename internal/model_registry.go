@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// ollamaDefaultNumCtx is the context window Ollama loads models with when num_ctx isn't set
+const ollamaDefaultNumCtx = 4096
+
+// ModelCapabilities describes the limits of a model, in tokens
+type ModelCapabilities struct {
+	ContextWindow int
+	MaxOutput     int
+	Encoding      string // token encoding, see system.GetTokenizer
+}
+
+// knownModels holds the published limits of common models, keyed by model name prefix.
+// Names are matched without the provider prefix, e.g. "google/gemini-2.5-pro" matches "gemini-2.5-pro",
+// and the longest matching prefix wins. Models can override these with context_window, max_output and tokenizer.
+// Models from other vendors get cl100k_base, which is a much closer estimate than the heuristic.
+var knownModels = map[string]ModelCapabilities{
+	// OpenAI
+	"gpt-5":         {ContextWindow: 400000, MaxOutput: 128000, Encoding: system.EncodingO200k},
+	"gpt-4.1":       {ContextWindow: 1047576, MaxOutput: 32768, Encoding: system.EncodingO200k},
+	"gpt-4o":        {ContextWindow: 128000, MaxOutput: 16384, Encoding: system.EncodingO200k},
+	"gpt-4-turbo":   {ContextWindow: 128000, MaxOutput: 4096, Encoding: system.EncodingCL100k},
+	"gpt-4":         {ContextWindow: 8192, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+	"gpt-3.5-turbo": {ContextWindow: 16385, MaxOutput: 4096, Encoding: system.EncodingCL100k},
+	"gpt-oss":       {ContextWindow: 131072, MaxOutput: 131072, Encoding: system.EncodingO200k},
+	"o1":            {ContextWindow: 200000, MaxOutput: 100000, Encoding: system.EncodingO200k},
+	"o3":            {ContextWindow: 200000, MaxOutput: 100000, Encoding: system.EncodingO200k},
+	"o4-mini":       {ContextWindow: 200000, MaxOutput: 100000, Encoding: system.EncodingO200k},
+
+	// Anthropic
+	"claude-opus-4":     {ContextWindow: 200000, MaxOutput: 32000, Encoding: system.EncodingCL100k},
+	"claude-sonnet-4":   {ContextWindow: 200000, MaxOutput: 64000, Encoding: system.EncodingCL100k},
+	"claude-haiku-4":    {ContextWindow: 200000, MaxOutput: 64000, Encoding: system.EncodingCL100k},
+	"claude-3-7-sonnet": {ContextWindow: 200000, MaxOutput: 64000, Encoding: system.EncodingCL100k},
+	"claude-3-5-sonnet": {ContextWindow: 200000, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+	"claude-3-5-haiku":  {ContextWindow: 200000, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+	"claude-3":          {ContextWindow: 200000, MaxOutput: 4096, Encoding: system.EncodingCL100k},
+
+	// Google
+	"gemini-2.5":     {ContextWindow: 1048576, MaxOutput: 65536, Encoding: system.EncodingCL100k},
+	"gemini-2.0":     {ContextWindow: 1048576, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+	"gemini-1.5-pro": {ContextWindow: 2097152, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+	"gemini-1.5":     {ContextWindow: 1048576, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+	"gemma-3":        {ContextWindow: 131072, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+
+	// Others
+	"deepseek-chat":     {ContextWindow: 128000, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+	"deepseek-reasoner": {ContextWindow: 128000, MaxOutput: 65536, Encoding: system.EncodingCL100k},
+	"deepseek-r1":       {ContextWindow: 128000, MaxOutput: 32768, Encoding: system.EncodingCL100k},
+	"grok-4":            {ContextWindow: 256000, MaxOutput: 32768, Encoding: system.EncodingCL100k},
+	"grok-3":            {ContextWindow: 131072, MaxOutput: 16384, Encoding: system.EncodingCL100k},
+	"mistral-large":     {ContextWindow: 131072, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+	"codestral":         {ContextWindow: 256000, MaxOutput: 8192, Encoding: system.EncodingCL100k},
+	"qwen3-coder":       {ContextWindow: 262144, MaxOutput: 65536, Encoding: system.EncodingCL100k},
+	"kimi-k2":           {ContextWindow: 131072, MaxOutput: 16384, Encoding: system.EncodingCL100k},
+}
+
+// lookupModelCapabilities returns the limits of a model from the known models table
+func lookupModelCapabilities(model string) (ModelCapabilities, bool) {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	var best string
+	for prefix := range knownModels {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return ModelCapabilities{}, false
+	}
+	return knownModels[best], true
+}
+
+// modelCapabilities returns the limits of a model configuration: the configured values,
+// then the known models table. Ollama models are limited to the num_ctx they're loaded with.
+func modelCapabilities(modelConfig config.ModelConfig) ModelCapabilities {
+	capabilities, _ := lookupModelCapabilities(modelConfig.Model)
+
+	if modelConfig.Provider == "ollama" {
+		capabilities.ContextWindow = ollamaDefaultNumCtx
+		if modelConfig.NumCtx > 0 {
+			capabilities.ContextWindow = modelConfig.NumCtx
+		}
+	}
+	if modelConfig.ContextWindow > 0 {
+		capabilities.ContextWindow = modelConfig.ContextWindow
+	}
+	if modelConfig.MaxOutput > 0 {
+		capabilities.MaxOutput = modelConfig.MaxOutput
+	}
+	if modelConfig.Tokenizer != "" {
+		capabilities.Encoding = modelConfig.Tokenizer
+	}
+	return capabilities
+}
+
+// tokenizerFor returns the tokenizer of a model configuration, the heuristic if its encoding is unknown
+func tokenizerFor(modelConfig config.ModelConfig) system.Tokenizer {
+	return system.GetTokenizer(modelCapabilities(modelConfig).Encoding)
+}
+
+// countTokens counts the tokens of a text with the tokenizer of the current model
+func (m *Manager) countTokens(text string) int {
+	if modelConfig, exists := m.GetCurrentModelConfig(); exists {
+		return tokenizerFor(modelConfig).CountTokens(text)
+	}
+	return system.EstimateTokenCount(text)
+}
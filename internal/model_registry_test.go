@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupModelCapabilities(t *testing.T) {
+	tests := []struct {
+		model         string
+		found         bool
+		contextWindow int
+	}{
+		{"gpt-4o", true, 128000},
+		{"gpt-4o-mini", true, 128000},
+		{"gpt-4", true, 8192},
+		{"gpt-4.1-mini", true, 1047576},
+		{"openai/gpt-5-codex", true, 400000},
+		{"google/gemini-2.5-flash-preview", true, 1048576},
+		{"anthropic/claude-sonnet-4-5", true, 200000},
+		{"Claude-3-5-Haiku-Latest", true, 200000},
+		{"my-finetune", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			capabilities, found := lookupModelCapabilities(tt.model)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.contextWindow, capabilities.ContextWindow)
+		})
+	}
+}
+
+func TestMaxContextSizeFollowsModel(t *testing.T) {
+	manager := &Manager{
+		Config: &config.Config{
+			DefaultModel: "gemini",
+			Models: map[string]config.ModelConfig{
+				"gemini": {Provider: "openrouter", Model: "google/gemini-2.5-pro", APIKey: "key"},
+				"local":  {Provider: "ollama", Model: "qwen2.5-coder:7b", NumCtx: 32768},
+				"small":  {Provider: "ollama", Model: "llama3.2"},
+				"custom": {Provider: "openrouter", Model: "gpt-4o", APIKey: "key", ContextWindow: 64000, MaxOutput: 2048},
+				"other":  {Provider: "openrouter", Model: "my-finetune", APIKey: "key"},
+			},
+		},
+		SessionOverrides: make(map[string]interface{}),
+	}
+
+	assert.Equal(t, 1048576, manager.GetMaxContextSize())
+	assert.Equal(t, 65536, manager.GetMaxOutput())
+
+	manager.SetModelsDefault("local")
+	assert.Equal(t, 32768, manager.GetMaxContextSize())
+
+	manager.SetModelsDefault("small")
+	assert.Equal(t, ollamaDefaultNumCtx, manager.GetMaxContextSize())
+
+	manager.SetModelsDefault("custom")
+	assert.Equal(t, 64000, manager.GetMaxContextSize())
+	assert.Equal(t, 2048, manager.GetMaxOutput())
+
+	manager.SetModelsDefault("other")
+	assert.Equal(t, defaultMaxContextSize, manager.GetMaxContextSize())
+	assert.Equal(t, 0, manager.GetMaxOutput())
+
+	// A max_context_size below the context window caps it, above it the window applies
+	manager.Config.MaxContextSize = 20000
+	assert.Equal(t, 20000, manager.GetMaxContextSize())
+	manager.SetModelsDefault("gemini")
+	size, source := manager.maxContextSize()
+	assert.Equal(t, 20000, size)
+	assert.Equal(t, "max_context_size, the model allows 1048576", source)
+	manager.SetModelsDefault("local")
+	manager.Config.MaxContextSize = 2000000
+	assert.Equal(t, 32768, manager.GetMaxContextSize())
+
+	// An explicit /config set still wins
+	manager.SessionOverrides["max_context_size"] = 5000
+	assert.Equal(t, 5000, manager.GetMaxContextSize())
+}
+
+func TestModelTokenizer(t *testing.T) {
+	assert.Equal(t, system.EncodingO200k, tokenizerFor(config.ModelConfig{Model: "openai/gpt-4o-mini"}).Name())
+	assert.Equal(t, system.EncodingCL100k, tokenizerFor(config.ModelConfig{Model: "gpt-3.5-turbo"}).Name())
+	assert.Equal(t, system.EncodingCL100k, tokenizerFor(config.ModelConfig{Model: "claude-sonnet-4-5"}).Name())
+	assert.Equal(t, system.EncodingHeuristic, tokenizerFor(config.ModelConfig{Model: "my-finetune"}).Name())
+	assert.Equal(t, system.EncodingO200k, tokenizerFor(config.ModelConfig{Model: "my-finetune", Tokenizer: "o200k_base"}).Name())
+	assert.Equal(t, system.EncodingHeuristic, tokenizerFor(config.ModelConfig{Model: "gpt-4o", Tokenizer: "heuristic"}).Name())
+}
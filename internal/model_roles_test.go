@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRolesTestManager(t *testing.T, roles config.ModelRoles) (*Manager, *AiClient) {
+	smart := writeMockScript(t, "smart.yaml", `responses:
+  - match: "."
+    response: "from smart"
+`)
+	fast := writeMockScript(t, "fast.yaml", `responses:
+  - match: "."
+    response: "from fast"
+`)
+	manager, client := newTestClient(t, config.ModelConfig{Provider: "mock", Model: "demo", Script: smart})
+	manager.Config.DefaultModel = "smart"
+	manager.Config.ModelRoles = roles
+	manager.Config.Models = map[string]config.ModelConfig{
+		"smart": {Provider: "mock", Model: "smart-model", Script: smart},
+		"fast":  {Provider: "mock", Model: "fast-model", Script: fast},
+	}
+	return manager, client
+}
+
+func TestGetRoleModel(t *testing.T) {
+	manager, _ := newRolesTestManager(t, config.ModelRoles{Chat: "fast", Summarize: "smart", Reflect: "missing"})
+
+	assert.Equal(t, "fast", manager.GetModelsDefault())
+	assert.Equal(t, "fast", manager.GetRoleModel(RoleChat))
+	assert.Equal(t, "fast", manager.GetRoleModel(RoleWatch))
+	assert.Equal(t, "smart", manager.GetRoleModel(RoleSummarize))
+	assert.Equal(t, "fast", manager.GetRoleModel(RoleReflect), "unknown models fall back to the chat model")
+
+	// /model and /config set still win over the configuration file
+	manager.SetModelsDefault("smart")
+	manager.SessionOverrides["model_roles.watch"] = "fast"
+	assert.Equal(t, "smart", manager.GetRoleModel(RoleChat))
+	assert.Equal(t, "fast", manager.GetRoleModel(RoleWatch))
+	assert.Equal(t, "smart", manager.GetRoleModel(RoleReflect))
+}
+
+func TestModelRoleRouting(t *testing.T) {
+	manager, client := newRolesTestManager(t, config.ModelRoles{Watch: "fast", Summarize: "fast"})
+	messages := []ChatMessage{{Content: "system prompt"}, {Content: "hello", FromUser: true}}
+
+	response, err := client.GetResponseFromChatMessages(context.Background(), messages, manager.GetModel())
+	require.NoError(t, err)
+	assert.Equal(t, "from smart", response)
+	assert.Equal(t, "smart", manager.AnsweringModel)
+
+	// Background work is recorded in the usage, but is not an answer in the conversation
+	response, err = client.GetResponseFromChatMessages(withModelRole(context.Background(), RoleSummarize), messages, manager.GetModel())
+	require.NoError(t, err)
+	assert.Equal(t, "from fast", response)
+	assert.Equal(t, "smart", manager.AnsweringModel)
+	models, _ := manager.usageTracker().ByModel()
+	assert.Equal(t, []string{"fast", "smart"}, models)
+
+	response, err = client.GetResponseFromChatMessages(withModelRole(context.Background(), RoleWatch), messages, manager.GetModel())
+	require.NoError(t, err)
+	assert.Equal(t, "from fast", response)
+	assert.Equal(t, "fast", manager.AnsweringModel)
+
+	// The reflect role has no model of its own
+	response, err = client.GetResponseFromChatMessages(withModelRole(context.Background(), RoleReflect), messages, manager.GetModel())
+	require.NoError(t, err)
+	assert.Equal(t, "from smart", response)
+}
+
+func TestSummarizeUsesSummarizeModel(t *testing.T) {
+	manager, _ := newRolesTestManager(t, config.ModelRoles{Summarize: "fast"})
+
+	summary, err := manager.summarizeChatHistory([]ChatMessage{{Content: "question", FromUser: true}, {Content: "answer"}})
+	require.NoError(t, err)
+	assert.Equal(t, "CHAT HISTORY SUMMARY:\nfrom fast", summary)
+}
@@ -1,7 +1,11 @@
 package internal
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/alvinunreal/tmuxai/config"
 	"github.com/stretchr/testify/assert"
@@ -191,4 +195,73 @@ func TestModelSorting(t *testing.T) {
 		// Should auto-select first alphabetically
 		assert.Equal(t, "alpha", manager.GetModelsDefault())
 	})
-}
\ No newline at end of file
+}
+
+func TestOllamaModelDiscovery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Tenant") != "acme" {
+			t.Errorf("the headers of the configured model are not sent, got %q", r.Header.Get("X-Tenant"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"models":[{"name":"qwen2.5-coder:7b"},{"name":"llama3:8b"},{"name":"local"}]}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		DefaultModel: "local",
+		Models: map[string]config.ModelConfig{
+			"local": {Provider: "ollama", Model: "llama3:8b", BaseURL: server.URL, KeepAlive: "5m", Headers: map[string]string{"X-Tenant": "acme"}},
+		},
+	}
+	manager := &Manager{
+		Config:           cfg,
+		SessionOverrides: make(map[string]interface{}),
+	}
+
+	manager.discoverOllamaModels(context.Background())
+
+	// configured names shadow discovered ones
+	assert.Equal(t, []string{"llama3:8b", "qwen2.5-coder:7b"}, manager.GetOllamaModels())
+	assert.Equal(t, []string{"local"}, manager.GetAvailableModels())
+
+	modelConfig, exists := manager.GetModelConfig("qwen2.5-coder:7b")
+	require.True(t, exists)
+	assert.Equal(t, "ollama", modelConfig.Provider)
+	assert.Equal(t, "qwen2.5-coder:7b", modelConfig.Model)
+	assert.Equal(t, server.URL, modelConfig.BaseURL)
+	assert.Equal(t, "5m", modelConfig.KeepAlive)
+	assert.Equal(t, map[string]string{"X-Tenant": "acme"}, modelConfig.Headers)
+
+	manager.switchModel(context.Background(), "qwen2.5-coder:7b")
+	assert.Equal(t, "qwen2.5-coder:7b", manager.GetModelsDefault())
+	assert.Equal(t, "qwen2.5-coder:7b", manager.GetModel())
+	assert.True(t, manager.hasValidAIConfiguration(), "Ollama models don't need an API key")
+}
+
+func TestOllamaModelDiscoveryCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	manager := &Manager{
+		Config: &config.Config{Models: map[string]config.ModelConfig{
+			"local": {Provider: "ollama", Model: "llama3:8b", BaseURL: server.URL},
+		}},
+		SessionOverrides: make(map[string]interface{}),
+		OllamaModels:     map[string]config.ModelConfig{"qwen2.5-coder:7b": {Provider: "ollama", Model: "qwen2.5-coder:7b"}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	manager.switchModel(ctx, "missing")
+
+	assert.Less(t, time.Since(started), 5*time.Second, "Ctrl+C stops the discovery")
+	assert.Equal(t, []string{"qwen2.5-coder:7b"}, manager.GetOllamaModels(), "a canceled discovery keeps the models found before")
+}
@@ -2,9 +2,11 @@ package internal
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
 	"github.com/alvinunreal/tmuxai/system"
 )
 
@@ -48,9 +50,12 @@ func (m *Manager) getTmuxPanesInXmlFn(config *config.Config) string {
 		}
 
 		var title string
-		if pane.IsTmuxAiExecPane {
+		switch {
+		case pane.IsTmuxAiExecPane:
 			title = "tmuxai_exec_pane"
-		} else {
+		case m.isPaneWritable(pane.Id):
+			title = "writable_pane"
+		default:
 			title = "read_only_pane"
 		}
 
@@ -82,3 +87,106 @@ func (m *Manager) getTmuxPanesInXmlFn(config *config.Config) string {
 	currentTmuxWindow.WriteString("</current_tmux_window_state>\n")
 	return currentTmuxWindow.String()
 }
+
+// isPaneWritable reports whether the AI may act in a pane: the exec pane, the panes of writable_panes
+// and the panes allowed with /pane allow, unless they were denied with /pane deny
+func (m *Manager) isPaneWritable(id string) bool {
+	// never the pane TmuxAI itself runs in, the AI would type into its own prompt
+	if id != "" && id == m.PaneId {
+		return false
+	}
+	if id == "" || id == m.ExecPane.Id {
+		return true
+	}
+	if writable, exists := m.AllowedPanes[id]; exists {
+		return writable
+	}
+	return slices.Contains(m.Config.WritablePanes, id)
+}
+
+// checkWritablePanes drops the TmuxAI pane from writable_panes, the AI must never type into its own prompt
+func (m *Manager) checkWritablePanes() {
+	if !slices.Contains(m.Config.WritablePanes, m.PaneId) {
+		return
+	}
+	logger.Warn("writable_panes contains the TmuxAI pane %s, ignoring it", m.PaneId)
+	m.Println(fmt.Sprintf("Warning: writable_panes contains the TmuxAI pane %s, it stays read only.", m.PaneId))
+	m.Config.WritablePanes = slices.DeleteFunc(slices.Clone(m.Config.WritablePanes), func(id string) bool {
+		return id == m.PaneId
+	})
+}
+
+// hasWritablePanes reports whether the AI may act in any pane besides the exec pane
+func (m *Manager) hasWritablePanes() bool {
+	return len(m.writablePaneIds()) > 0
+}
+
+// writablePaneIds lists the panes besides the exec pane the AI may act in, sorted
+func (m *Manager) writablePaneIds() []string {
+	var ids []string
+	for id := range m.AllowedPanes {
+		if m.isPaneWritable(id) && id != m.ExecPane.Id {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range m.Config.WritablePanes {
+		if m.isPaneWritable(id) && id != m.ExecPane.Id && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// targetPane returns the id of the pane an action goes to, the exec pane when it has no pane attribute
+func (m *Manager) targetPane(pane string) string {
+	if pane == "" {
+		return m.ExecPane.Id
+	}
+	return pane
+}
+
+// panePrompt names the target pane in a confirmation prompt, unless it is the exec pane
+func (m *Manager) panePrompt(prompt string, pane string) string {
+	if pane == "" || pane == m.ExecPane.Id {
+		return prompt
+	}
+	return strings.TrimSuffix(prompt, "?") + " in pane " + pane + "?"
+}
+
+// setPaneWritable allows or denies the AI to act in a pane for the rest of the session
+func (m *Manager) setPaneWritable(id string, writable bool) error {
+	if !config.ValidPaneID(id) {
+		return fmt.Errorf("invalid pane id %s, pane ids look like %%2", id)
+	}
+	if id == m.ExecPane.Id {
+		return fmt.Errorf("pane %s is the exec pane, it is always writable", id)
+	}
+	if id == m.PaneId {
+		return fmt.Errorf("pane %s is the TmuxAI pane, the AI cannot act in it", id)
+	}
+	if m.AllowedPanes == nil {
+		m.AllowedPanes = make(map[string]bool)
+	}
+	m.AllowedPanes[id] = writable
+	return nil
+}
+
+// listPanes shows the panes of the window and whether the AI may act in them
+func (m *Manager) listPanes() {
+	panes, _ := m.GetTmuxPanes()
+	for _, pane := range panes {
+		var access string
+		switch {
+		case pane.IsTmuxAiPane:
+			continue
+		case pane.IsTmuxAiExecPane:
+			access = "exec pane"
+		case m.isPaneWritable(pane.Id):
+			access = "writable"
+		default:
+			access = "read only"
+		}
+		m.Println(fmt.Sprintf("%s %s (%s)", pane.Id, pane.CurrentCommand, access))
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPaneWritable(t *testing.T) {
+	manager, _ := newLoopTestManager()
+	manager.ExecPane.Id = "%1"
+	manager.Config.WritablePanes = []string{"%2", "%3"}
+
+	assert.True(t, manager.isPaneWritable(""))
+	assert.True(t, manager.isPaneWritable("%1"))
+	assert.True(t, manager.isPaneWritable("%2"))
+	assert.False(t, manager.isPaneWritable("%4"))
+
+	// /pane allow and deny override writable_panes for the session
+	require.NoError(t, manager.setPaneWritable("%4", true))
+	require.NoError(t, manager.setPaneWritable("%2", false))
+	assert.True(t, manager.isPaneWritable("%4"))
+	assert.False(t, manager.isPaneWritable("%2"))
+	assert.Equal(t, []string{"%3", "%4"}, manager.writablePaneIds())
+
+	assert.Error(t, manager.setPaneWritable("2", true))
+	assert.Error(t, manager.setPaneWritable("%1", false), "the exec pane is always writable")
+
+	// The TmuxAI pane stays read only, whatever the configuration says
+	manager.PaneId = "%0"
+	manager.Config.WritablePanes = append(manager.Config.WritablePanes, "%0")
+	assert.Error(t, manager.setPaneWritable("%0", true))
+	assert.False(t, manager.isPaneWritable("%0"))
+	manager.checkWritablePanes()
+	assert.Equal(t, []string{"%2", "%3"}, manager.Config.WritablePanes)
+
+	assert.Equal(t, "Execute this command?", manager.panePrompt("Execute this command?", "%1"))
+	assert.Equal(t, "Execute this command in pane %3?", manager.panePrompt("Execute this command?", "%3"))
+}
+
+// Test: Actions with a pane attribute go to that pane once it is writable
+func TestProcessUserMessage_WritablePane(t *testing.T) {
+	manager, _ := newLoopTestManager(
+		"<ExecCommand pane=\"%3\">make test</ExecCommand>",
+		"<RequestAccomplished>1</RequestAccomplished>",
+	)
+	manager.ExecPane.Id = "%1"
+	manager.Config.ExecConfirm = true
+	var prompts []string
+	manager.confirmedToExec = func(command string, prompt string, edit bool) (bool, string) {
+		prompts = append(prompts, prompt)
+		return true, command
+	}
+	var panes []string
+	originalSend := system.TmuxSendCommandToPane
+	t.Cleanup(func() { system.TmuxSendCommandToPane = originalSend })
+	system.TmuxSendCommandToPane = func(paneId string, command string, enter bool) error {
+		panes = append(panes, paneId)
+		return nil
+	}
+
+	// Pane %3 is read only, so the AI is asked again until it is allowed
+	guidelineError, valid := manager.aiFollowedGuidelines(AIResponse{ExecCommand: []string{"make test"}, Pane: "%3"})
+	assert.False(t, valid)
+	assert.Contains(t, guidelineError, "Pane %3 is a read_only_pane")
+
+	require.NoError(t, manager.setPaneWritable("%3", true))
+	assert.True(t, manager.ProcessUserMessage(context.Background(), "run the tests"))
+	assert.Equal(t, []string{"%3"}, panes)
+	assert.Equal(t, []string{"Execute this command in pane %3?"}, prompts)
+	assert.Equal(t, []StepAction{{Kind: "exec", Content: "make test", Pane: "%3", Executed: true}}, manager.Trace[0].Actions)
+	assert.Contains(t, manager.chatAssistantPrompt(false).Content, `<ExecCommand pane="%2">`)
+}
@@ -0,0 +1,323 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/briandowns/spinner"
+	"github.com/fatih/color"
+)
+
+// PlanStep is one step of a plan: a shell command and what it is for
+type PlanStep struct {
+	Description string
+	Command     string
+}
+
+// Plan is what the AI proposes for a /plan task, the user approves it before anything runs
+type Plan struct {
+	Task    string
+	Message string // what the AI wrote besides the steps
+	Steps   []PlanStep
+}
+
+var (
+	planStepRegex        = regexp.MustCompile(`(?s)<PlanStep>(.*?)</PlanStep>`)
+	planDescriptionRegex = regexp.MustCompile(`(?s)<Description>(.*?)</Description>`)
+	planCommandRegex     = regexp.MustCompile(`(?s)<Command>(.*?)</Command>`)
+	emptyCodeBlockRegex  = regexp.MustCompile("(?s)```(?:xml)?\\s*```")
+)
+
+// parsePlan reads the PlanStep tags of a response, steps without a command are left out
+func parsePlan(task string, response string) Plan {
+	message := planStepRegex.ReplaceAllString(response, "")
+	message = emptyCodeBlockRegex.ReplaceAllString(message, "")
+	plan := Plan{Task: task, Message: strings.TrimSpace(message)}
+
+	for _, match := range planStepRegex.FindAllStringSubmatch(response, -1) {
+		var step PlanStep
+		if description := planDescriptionRegex.FindStringSubmatch(match[1]); description != nil {
+			step.Description = strings.TrimSpace(html.UnescapeString(description[1]))
+		}
+		if command := planCommandRegex.FindStringSubmatch(match[1]); command != nil {
+			step.Command = strings.TrimSpace(html.UnescapeString(command[1]))
+		}
+		if step.Command != "" {
+			plan.Steps = append(plan.Steps, step)
+		}
+	}
+	return plan
+}
+
+// formatPlanText writes the steps of a plan as text for the user to edit:
+// one command per line, each under a comment line describing it
+func formatPlanText(plan Plan) string {
+	var builder strings.Builder
+	builder.WriteString("# Plan for: " + strings.Join(strings.Fields(plan.Task), " ") + "\n")
+	builder.WriteString("# Each line below is a command, run as one step in this order.\n")
+	builder.WriteString("# Edit, reorder or delete lines to change the plan, the comment above a command describes it.\n")
+	builder.WriteString("# Save an empty plan to cancel.\n")
+	for _, step := range plan.Steps {
+		builder.WriteString("\n")
+		if step.Description != "" {
+			builder.WriteString("# " + step.Description + "\n")
+		}
+		builder.WriteString(step.Command + "\n")
+	}
+	return builder.String()
+}
+
+// parsePlanText reads back the steps of a plan edited as text, see formatPlanText.
+// Comment lines right above a command describe it, a blank line ends a comment.
+func parsePlanText(text string) []PlanStep {
+	var steps []PlanStep
+	var description []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			description = nil
+		case strings.HasPrefix(line, "#"):
+			description = append(description, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+		default:
+			steps = append(steps, PlanStep{Description: strings.Join(description, " "), Command: line})
+			description = nil
+		}
+	}
+	return steps
+}
+
+// printPlan shows the numbered steps of a plan
+func (m *Manager) printPlan(plan Plan) {
+	if plan.Message != "" {
+		fmt.Println(system.Cosmetics(plan.Message))
+	}
+	for i, step := range plan.Steps {
+		description := step.Description
+		if description == "" {
+			description = "(no description)"
+		}
+		m.Println(fmt.Sprintf("%d. %s", i+1, description))
+		code, _ := system.HighlightCode("sh", step.Command)
+		fmt.Println("   " + code)
+	}
+}
+
+// reviewPlanFn shows a plan and lets the user approve it, edit and reorder its steps in an editor, or cancel it.
+// It returns the plan as approved, false when it was canceled.
+func (m *Manager) reviewPlanFn(plan Plan) (Plan, bool) {
+	for {
+		m.printPlan(plan)
+
+		promptText := color.New(color.FgCyan, color.Bold).Sprint("Run this plan? [Y]es/No/Edit: ")
+		input, cancelled, err := readConfirmationInput(promptText)
+		if err != nil {
+			fmt.Printf("Error reading confirmation: %v\n", err)
+			return plan, false
+		}
+		if cancelled {
+			return plan, false
+		}
+
+		switch strings.TrimSpace(strings.ToLower(input)) {
+		case "", "y", "yes", "ok", "sure":
+			return plan, true
+		case "n", "no", "cancel":
+			return plan, false
+		case "e", "edit":
+			edited, err := editInEditor(formatPlanText(plan), "tmuxai-plan-*.sh")
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			plan.Message = ""
+			plan.Steps = parsePlanText(edited)
+			if len(plan.Steps) == 0 {
+				return plan, false
+			}
+		}
+	}
+}
+
+// requestPlan asks the AI for a plan, or a revised one, and keeps the exchange in the chat history
+func (m *Manager) requestPlan(ctx context.Context, task string, message string) (Plan, error) {
+	if !m.hasValidAIConfiguration() {
+		return Plan{}, fmt.Errorf("no AI configuration found, see /model")
+	}
+
+	history, currentMessage := m.composeHistory(message)
+	history[0] = m.planPrompt()
+	sending := append(history, currentMessage)
+
+	if err := m.checkBudget(sending); err != nil {
+		return Plan{}, err
+	}
+
+	s := spinner.New(spinner.CharSets[26], 100*time.Millisecond)
+	m.showRetries(s)
+	s.Start()
+	response, err := m.AiClient.GetResponseFromChatMessages(withModelRole(ctx, RoleChat), sending, m.GetModel())
+	s.Stop()
+	if err != nil {
+		if m.Config.Debug {
+			debugChatMessages(sending, "ERROR: "+err.Error())
+		}
+		return Plan{}, err
+	}
+	if m.Config.Debug {
+		debugChatMessages(sending, response)
+	}
+
+	m.Messages = append(m.Messages, currentMessage, ChatMessage{
+		Content:   response,
+		FromUser:  false,
+		Timestamp: time.Now(),
+	})
+
+	m.notifyHook(ctx, HookEvent{Event: HookOnResponse, Request: task, Response: response, Model: m.AnsweringModel})
+
+	plan := parsePlan(task, response)
+	logger.Debug("Plan with %d steps for: %s", len(plan.Steps), task)
+	return plan, nil
+}
+
+// planRevisionMessage tells the AI which step of the plan failed, to have the rest of it planned again
+func planRevisionMessage(plan Plan, failed int, result CommandExecHistory) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Step %d of the plan failed.\n", failed+1))
+	builder.WriteString(fmt.Sprintf("Command: %s\nExit code: %d\n", result.Command, result.Code))
+	if output := strings.TrimSpace(result.Output); output != "" {
+		builder.WriteString("Output:\n" + truncateForReflection(output, 4000) + "\n")
+	}
+	if failed > 0 {
+		builder.WriteString("\nThese steps already succeeded, do not repeat them:\n")
+		for i, step := range plan.Steps[:failed] {
+			builder.WriteString(fmt.Sprintf("%d. %s\n", i+1, step.Command))
+		}
+	}
+	if failed+1 < len(plan.Steps) {
+		builder.WriteString("\nThese steps were still to run:\n")
+		for i, step := range plan.Steps[failed+1:] {
+			builder.WriteString(fmt.Sprintf("%d. %s\n", failed+i+2, step.Command))
+		}
+	}
+	builder.WriteString("\nPlan the rest of the task again, starting with fixing the failed step.")
+	return builder.String()
+}
+
+// runPlanStep executes one approved step like any other command, through the confirmation and the exec pane.
+// It returns the captured result when the exec pane is prepared, false when the step was declined or vetoed.
+// A dry run only shows the command and reports it as successful.
+func (m *Manager) runPlanStep(ctx context.Context, task string, step PlanStep) (CommandExecHistory, bool, error) {
+	command, allowed := m.preExecHook(ctx, task, m.ExecPane.Id, step.Command)
+	if !allowed {
+		return CommandExecHistory{}, false, nil
+	}
+
+	if m.DryRun {
+		m.Println("Dry run, not executing command: " + command)
+		return CommandExecHistory{Command: command}, true, nil
+	}
+
+	if m.GetExecConfirm() {
+		var isSafe bool
+		isSafe, command = m.confirmedToExec(command, "Execute this step?", true)
+		if !isSafe {
+			return CommandExecHistory{}, false, nil
+		}
+	}
+
+	m.Println("Executing command: " + command)
+	history, err := m.execInPane(ctx, task, "", command)
+	return history, true, err
+}
+
+// runPlan runs /plan: asks the AI for a plan, has the user approve it and executes it step by step.
+// When a step fails the rest of the plan is revised and approved again, up to max_retries times.
+// Returns true if every step of the plan ran.
+func (m *Manager) runPlan(ctx context.Context, task string) bool {
+	defer m.processPendingReflections(ctx)
+
+	plan, err := m.requestPlan(ctx, task, "Make a plan for this task: "+task)
+	if err != nil {
+		m.Println("Failed to get a plan: " + err.Error())
+		m.notifyHook(ctx, HookEvent{Event: HookOnError, Request: task, Error: err.Error()})
+		return false
+	}
+
+	if !m.ExecPane.IsPrepared {
+		m.Println("The exec pane is not prepared, failed steps cannot be detected. Run /prepare first to have the plan revised when a step fails.")
+	}
+
+	maxRevisions := m.GetMaxRetries()
+	for revisions := 0; ; revisions++ {
+		if len(plan.Steps) == 0 {
+			if plan.Message != "" {
+				fmt.Println(system.Cosmetics(plan.Message))
+			}
+			m.Println("No plan steps to run.")
+			return false
+		}
+
+		var approved bool
+		plan, approved = m.reviewPlan(plan)
+		if !approved {
+			m.Println("Plan canceled.")
+			return false
+		}
+
+		failed := -1
+		var failure CommandExecHistory
+		for i, step := range plan.Steps {
+			if m.Status == "" || ctx.Err() != nil {
+				m.Println("Plan canceled.")
+				return false
+			}
+
+			label := step.Description
+			if label == "" {
+				label = step.Command
+			}
+			m.Println(fmt.Sprintf("Step %d/%d: %s", i+1, len(plan.Steps), label))
+			result, executed, err := m.runPlanStep(ctx, task, step)
+			if !executed {
+				m.Println(fmt.Sprintf("Plan stopped at step %d.", i+1))
+				return false
+			}
+			if err != nil {
+				m.Println(fmt.Sprintf("Plan stopped at step %d: %v", i+1, err))
+				return false
+			}
+			if result.Code != 0 {
+				failed, failure = i, result
+				break
+			}
+		}
+
+		if failed < 0 {
+			m.Println("Plan completed.")
+			m.notifyHook(ctx, HookEvent{Event: HookOnRequestAccomplished, Request: task, Steps: len(plan.Steps)})
+			return true
+		}
+
+		m.Println(fmt.Sprintf("Step %d failed with exit code %d.", failed+1, failure.Code))
+		if revisions >= maxRevisions {
+			m.Println(fmt.Sprintf("Stopped: the plan still fails after %d revisions, see max_retries", maxRevisions))
+			return false
+		}
+
+		m.Println("Revising the rest of the plan...")
+		plan, err = m.requestPlan(ctx, task, planRevisionMessage(plan, failed, failure))
+		if err != nil {
+			m.Println("Failed to revise the plan: " + err.Error())
+			m.notifyHook(ctx, HookEvent{Event: HookOnError, Request: task, Error: err.Error()})
+			return false
+		}
+	}
+}
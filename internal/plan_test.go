@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlan(t *testing.T) {
+	response := "I'll build and test it.\n```xml\n" +
+		"<PlanStep>\n<Description>Install the dependencies</Description>\n<Command>npm install</Command>\n</PlanStep>\n" +
+		"<PlanStep><Description>Run the tests</Description><Command>npm test &amp;&amp; echo ok</Command></PlanStep>\n" +
+		"<PlanStep><Description>Nothing to run</Description></PlanStep>\n```"
+
+	plan := parsePlan("build it", response)
+	assert.Equal(t, "build it", plan.Task)
+	assert.Equal(t, "I'll build and test it.", plan.Message)
+	assert.Equal(t, []PlanStep{
+		{Description: "Install the dependencies", Command: "npm install"},
+		{Description: "Run the tests", Command: "npm test && echo ok"},
+	}, plan.Steps)
+}
+
+func TestPlanText(t *testing.T) {
+	plan := Plan{Task: "build\nit", Steps: []PlanStep{
+		{Description: "Install the dependencies", Command: "npm install"},
+		{Command: "npm test"},
+	}}
+	text := formatPlanText(plan)
+	assert.True(t, strings.HasPrefix(text, "# Plan for: build it\n"))
+	assert.Equal(t, plan.Steps, parsePlanText(text))
+
+	// Steps are reordered and edited by moving and changing their lines
+	edited := "# Plan for: build it\n\n# Run the tests\n  npm test -- --watch=false\n# Install the dependencies\nnpm ci\n\n"
+	assert.Equal(t, []PlanStep{
+		{Description: "Run the tests", Command: "npm test -- --watch=false"},
+		{Description: "Install the dependencies", Command: "npm ci"},
+	}, parsePlanText(edited))
+
+	assert.Empty(t, parsePlanText(formatPlanText(Plan{Task: "nothing"})))
+}
+
+// newPlanTestManager runs plans against a prepared exec pane where the listed commands fail
+func newPlanTestManager(t *testing.T, failing map[string]int) (*Manager, *[]string) {
+	script := writeMockScript(t, "plan.yaml", `responses:
+  - match: "^\\{"
+    response: "{}"
+  - match: "Make a plan"
+    response: "<PlanStep><Description>Build</Description><Command>make build</Command></PlanStep><PlanStep><Description>Test</Description><Command>make test</Command></PlanStep><PlanStep><Description>Install</Description><Command>make install</Command></PlanStep>"
+  - match: "Step 2 of the plan failed"
+    response: "<PlanStep><Description>Fix the tests</Description><Command>make fix</Command></PlanStep><PlanStep><Description>Install</Description><Command>make install</Command></PlanStep>"
+`)
+	manager, _ := newTestClient(t, config.ModelConfig{Provider: "mock", Model: "demo", Script: script})
+	manager.Config.MaxContextSize = 1000000
+	manager.ExecPane = &system.TmuxPaneDetails{Id: "%1", IsPrepared: true}
+	manager.getTmuxPanesInXml = func(config *config.Config) string {
+		return "<tmux>mock pane content</tmux>"
+	}
+	manager.confirmedToExec = func(command string, prompt string, edit bool) (bool, string) {
+		return true, command
+	}
+	manager.reviewPlan = func(plan Plan) (Plan, bool) {
+		return plan, true
+	}
+
+	var executed []string
+	originalSend, originalCapture := system.TmuxSendCommandToPane, system.TmuxCapturePane
+	t.Cleanup(func() {
+		system.TmuxSendCommandToPane, system.TmuxCapturePane = originalSend, originalCapture
+	})
+	system.TmuxSendCommandToPane = func(paneId string, command string, enter bool) error {
+		executed = append(executed, command)
+		return nil
+	}
+	system.TmuxCapturePane = func(paneId string, maxLines int) (string, error) {
+		last := executed[len(executed)-1]
+		return fmt.Sprintf("user@host:~[10:00][0]» %s\noutput of %s\nuser@host:~[10:00][%d]» ", last, last, failing[last]), nil
+	}
+	return manager, &executed
+}
+
+func TestRunPlan(t *testing.T) {
+	manager, executed := newPlanTestManager(t, nil)
+
+	assert.True(t, manager.runPlan(context.Background(), "build and install"))
+	assert.Equal(t, []string{"make build", "make test", "make install"}, *executed)
+	// Reflections on the executed commands follow the exchange
+	require.NotEmpty(t, manager.Messages)
+	assert.Contains(t, manager.Messages[0].Content, "Make a plan for this task: build and install")
+}
+
+func TestRunPlan_RevisedAfterFailure(t *testing.T) {
+	manager, executed := newPlanTestManager(t, map[string]int{"make test": 2})
+	var reviewed [][]PlanStep
+	manager.reviewPlan = func(plan Plan) (Plan, bool) {
+		reviewed = append(reviewed, plan.Steps)
+		return plan, true
+	}
+
+	assert.True(t, manager.runPlan(context.Background(), "build and install"))
+	assert.Equal(t, []string{"make build", "make test", "make fix", "make install"}, *executed)
+
+	// The revised plan is approved again before it runs
+	require.Len(t, reviewed, 2)
+	assert.Equal(t, "make fix", reviewed[1][0].Command)
+	require.GreaterOrEqual(t, len(manager.Messages), 4)
+	revision := manager.Messages[2].Content
+	assert.Contains(t, revision, "Command: make test\nExit code: 2")
+	assert.Contains(t, revision, "output of make test")
+	assert.Contains(t, revision, "1. make build")
+	assert.Contains(t, revision, "3. make install")
+}
+
+func TestRunPlan_StopsAfterMaxRetries(t *testing.T) {
+	manager, executed := newPlanTestManager(t, map[string]int{"make test": 1, "make fix": 1})
+	manager.SessionOverrides["max_retries"] = 1
+
+	assert.False(t, manager.runPlan(context.Background(), "build and install"))
+	assert.Equal(t, []string{"make build", "make test", "make fix"}, *executed)
+}
+
+func TestRunPlan_DeclinedOrCanceled(t *testing.T) {
+	manager, executed := newPlanTestManager(t, nil)
+	manager.reviewPlan = func(plan Plan) (Plan, bool) {
+		return plan, false
+	}
+	assert.False(t, manager.runPlan(context.Background(), "build and install"))
+	assert.Empty(t, *executed)
+
+	manager, executed = newPlanTestManager(t, nil)
+	manager.reviewPlan = func(plan Plan) (Plan, bool) {
+		plan.Steps = []PlanStep{plan.Steps[2], plan.Steps[0]}
+		return plan, true
+	}
+	manager.Config.ExecConfirm = true
+	manager.confirmedToExec = func(command string, prompt string, edit bool) (bool, string) {
+		return command != "make build", command
+	}
+	assert.False(t, manager.runPlan(context.Background(), "build and install"))
+	assert.Equal(t, []string{"make install"}, *executed)
+}
+
+func TestRunPlan_DryRun(t *testing.T) {
+	manager, executed := newPlanTestManager(t, map[string]int{"make test": 2})
+	manager.DryRun = true
+
+	assert.True(t, manager.runPlan(context.Background(), "build and install"))
+	assert.Empty(t, *executed)
+}
+
+func TestRunPlan_ContextCanceled(t *testing.T) {
+	manager, executed := newPlanTestManager(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	manager.reviewPlan = func(plan Plan) (Plan, bool) {
+		cancel() // Ctrl+C while the plan is reviewed
+		return plan, true
+	}
+
+	assert.False(t, manager.runPlan(ctx, "build and install"))
+	assert.Empty(t, *executed)
+}
@@ -2,7 +2,9 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/alvinunreal/tmuxai/logger"
@@ -13,6 +15,78 @@ import (
 // Main function to process regular user messages
 // Returns true if the request was accomplished and no further processing should happen
 func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
+	defer m.processPendingReflections(ctx)
+
+	m.Trace = nil
+	request := message
+	maxSteps, maxRetries, maxBusyWaits := m.GetMaxSteps(), m.GetMaxRetries(), m.GetMaxBusyWaits()
+	retries, steps, busyWaits := 0, 0, 0
+	squashed := false
+
+	// Every step is a request to the AI, the loop goes on until the AI is done or a budget runs out.
+	// Waiting on a busy exec pane doesn't use up max_steps, long running commands are waited for
+	// up to max_busy_waits times.
+	for number := 1; ; number++ {
+		step := AgentStep{Number: number, Request: message, Started: time.Now()}
+		next := m.runStep(ctx, request, &step, !squashed)
+		step.Duration = time.Since(step.Started)
+
+		switch step.Outcome {
+		case StepContinue, StepBusy, StepRetry, StepSquashed:
+		default:
+			m.recordStep(step)
+			m.finishHooks(ctx, request, step)
+			return step.Outcome == StepAccomplished
+		}
+
+		if step.Outcome == StepBusy {
+			busyWaits++
+		} else {
+			steps++
+		}
+
+		var budgetErr error
+		switch {
+		case step.Outcome == StepRetry && retries >= maxRetries:
+			budgetErr = fmt.Errorf("the AI did not follow the guidelines after %d retries, see max_retries", maxRetries)
+		case step.Outcome == StepBusy && busyWaits >= maxBusyWaits:
+			budgetErr = fmt.Errorf("the exec pane is still busy after %d waits, see max_busy_waits", maxBusyWaits)
+		case steps >= maxSteps:
+			budgetErr = fmt.Errorf("the request is not finished after %d steps, see max_steps", maxSteps)
+		}
+		if budgetErr != nil {
+			step.Outcome = StepBudgetExceeded
+			step.Err = budgetErr
+			m.recordStep(step)
+			m.finishHooks(ctx, request, step)
+			m.Status = ""
+			m.Println("Stopped: " + budgetErr.Error())
+			return false
+		}
+		m.recordStep(step)
+
+		switch step.Outcome {
+		case StepRetry:
+			retries++
+		case StepSquashed:
+			squashed = true
+		}
+		message = next
+	}
+}
+
+// recordStep adds a finished step to the trace of the current request
+func (m *Manager) recordStep(step AgentStep) {
+	m.Trace = append(m.Trace, step)
+	logger.Debug("Agent %s", step.String())
+}
+
+// runStep sends one request to the AI and takes the actions of its answer, filling in the step.
+// The user's request is what the hooks are told the actions are for.
+// It returns the message to send in the next step when the loop goes on.
+func (m *Manager) runStep(ctx context.Context, request string, step *AgentStep, canSquash bool) string {
+	message := step.Request
+
 	// Check if context management is needed before sending
 	if m.needSquash() {
 		m.Println("Exceeded context size, squashing history...")
@@ -21,47 +95,17 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 
 	// Create and manage spinner inside the processing goroutine
 	s := spinner.New(spinner.CharSets[26], 100*time.Millisecond)
+	m.showRetries(s)
 	s.Start()
 	defer s.Stop()
-	defer m.processPendingReflections(ctx)
 
 	// Early exit if context is already canceled
 	if ctx.Err() != nil {
-		return false
-	}
-
-	currentTmuxWindow := m.getTmuxPanesInXml(m.Config)
-	execPaneEnv := ""
-	if !m.ExecPane.IsSubShell {
-		execPaneEnv = fmt.Sprintf("Keep in mind, you are working within the shell: %s and OS: %s", m.ExecPane.Shell, m.ExecPane.OS)
-	}
-	currentMessage := ChatMessage{
-		Content:   currentTmuxWindow + "\n\n" + execPaneEnv + "\n\n" + message,
-		FromUser:  true,
-		Timestamp: time.Now(),
-	}
-
-	// build current chat history
-	var history []ChatMessage
-	switch {
-	case m.WatchMode:
-		history = []ChatMessage{m.watchPrompt()}
-	case m.ExecPane.IsPrepared:
-		history = []ChatMessage{m.chatAssistantPrompt(true)}
-	default:
-		history = []ChatMessage{m.chatAssistantPrompt(false)}
-	}
-
-	// Inject loaded knowledge bases after system prompt
-	for kbName, kbContent := range m.LoadedKBs {
-		history = append(history, ChatMessage{
-			Content:   fmt.Sprintf("=== Knowledge Base: %s ===\n%s", kbName, kbContent),
-			FromUser:  false,
-			Timestamp: time.Now(),
-		})
+		step.Outcome = StepCanceled
+		return ""
 	}
 
-	history = append(history, m.Messages...)
+	history, currentMessage := m.composeHistory(message)
 
 	sending := append(history, currentMessage)
 
@@ -82,14 +126,50 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		fmt.Println("      provider: 'openrouter'")
 		fmt.Println("      model: 'google/gemini-2.5-flash-preview'")
 		fmt.Println("      api_key: 'sk-or-your-api-key'")
-		return false
+		step.Outcome = StepFailed
+		step.Err = fmt.Errorf("no AI configuration found")
+		return ""
 	}
 
-	response, err := m.AiClient.GetResponseFromChatMessages(ctx, sending, m.GetModel())
-	if err != nil {
+	// Stop the agent loop before a request that would go over budget
+	if err := m.checkBudget(sending); err != nil {
+		s.Stop()
+		m.Status = ""
+		m.Println("Budget exceeded: " + err.Error())
+		step.Outcome = StepBudgetExceeded
+		step.Err = err
+		return ""
+	}
+
+	// Prose is printed while it streams in, actions are only taken once the response is complete
+	printer := newStreamPrinter(s.Stop)
+	streamCtx := WithStreamHandler(ctx, printer.Write)
+
+	// Models configured for native tool calling get the actions as tools instead of XML tags
+	tools := &toolSession{Tools: actionTools(m.WatchMode, m.ExecPane.IsPrepared)}
+	streamCtx = withToolSession(streamCtx, tools)
+	role := RoleChat
+	if m.WatchMode {
+		role = RoleWatch
+	}
+	streamCtx = withModelRole(streamCtx, role)
+
+	// Reasoning summaries are only shown, and kept in the debug dump, never sent back as history
+	var reasoning strings.Builder
+	if m.showReasoning(role) {
+		streamCtx = WithReasoningHandler(streamCtx, func(delta string) {
+			reasoning.WriteString(delta)
+			printer.Reason(delta)
+		})
+	}
 
+	response, err := m.AiClient.GetResponseFromChatMessages(streamCtx, sending, m.GetModel())
+	printer.Flush()
+	if err != nil {
+		step.Err = err
 		if ctx.Err() == context.Canceled {
-			return false
+			step.Outcome = StepCanceled
+			return ""
 		}
 
 		// Log both to console and debug file to capture error context
@@ -101,16 +181,36 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 			debugChatMessages(append(history, currentMessage), "ERROR: "+err.Error())
 		}
 
-		return false
+		// The history may have outgrown the model's context window before needSquash noticed
+		if errors.Is(err, ErrContextLength) && canSquash {
+			s.Stop()
+			m.Println("Context length exceeded, squashing history and retrying...")
+			m.squashHistory()
+			step.Outcome = StepSquashed
+			return message
+		}
+
+		if hint := m.providerErrorHint(err); hint != "" {
+			m.Println(hint)
+		}
+		step.Outcome = StepFailed
+		return ""
 	}
+	step.Model = m.AnsweringModel
 
 	// check for status change again
 	if m.Status == "" {
 		s.Stop()
-		return false
+		step.Outcome = StepCanceled
+		return ""
 	}
 
 	r, err := m.parseAIResponse(response)
+	if err == nil && len(tools.Calls) > 0 {
+		err = applyToolCalls(&r, tools.Calls)
+		// Keep the calls in the history the same way XML tags are, so any model can follow it
+		response = strings.TrimSpace(response + "\n" + toolCallsToXML(tools.Calls))
+	}
 	if err != nil {
 		s.Stop()
 		m.Status = ""
@@ -121,14 +221,18 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 
 		// Debug the failed parsing even when there's an error
 		if m.Config.Debug {
-			debugChatMessages(append(history, currentMessage), "PARSE ERROR: "+response)
+			debugChatExchange(append(history, currentMessage), reasoning.String(), "PARSE ERROR: "+response)
 		}
 
-		return false
+		step.Outcome = StepFailed
+		step.Err = err
+		return ""
 	}
+	step.Response = r
+	m.notifyHook(ctx, HookEvent{Event: HookOnResponse, Request: request, Response: response, Model: step.Model})
 
 	if m.Config.Debug {
-		debugChatMessages(append(history, currentMessage), response)
+		debugChatExchange(append(history, currentMessage), reasoning.String(), response)
 	}
 
 	logger.Debug("AIResponse: %s", r.String())
@@ -146,12 +250,12 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 	if !validResponse {
 		m.Println("AI didn't follow guidelines, trying again...")
 		m.Messages = append(m.Messages, currentMessage, responseMsg)
-		return m.ProcessUserMessage(ctx, guidelineError)
-
+		step.Outcome = StepRetry
+		return guidelineError
 	}
 
-	// colorize code blocks in the response
-	if r.Message != "" {
+	// colorize code blocks in the response, unless it was already rendered while streaming
+	if r.Message != "" && !printer.Printed() {
 		fmt.Println(system.Cosmetics(r.Message))
 	}
 
@@ -161,41 +265,78 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		m.Messages = append(m.Messages, currentMessage, responseMsg)
 	}
 
+	// the pane the actions go to, empty for the exec pane
+	pane := r.Pane
+	if pane == m.ExecPane.Id {
+		pane = ""
+	}
+	target := m.targetPane(pane)
+
 	// observe/prepared mode
-	for _, execCommand := range r.ExecCommand {
+	for _, proposed := range r.ExecCommand {
+		// hooks may veto or rewrite the command before it is shown and confirmed
+		execCommand, allowed := m.preExecHook(ctx, request, target, proposed)
+		if !allowed {
+			step.Actions = append(step.Actions, StepAction{Kind: "exec", Content: proposed, Pane: pane})
+			m.Status = ""
+			step.Outcome = StepVetoed
+			return ""
+		}
+
 		code, _ := system.HighlightCode("sh", execCommand)
 		m.Println(code)
 
+		if m.DryRun {
+			m.Println("Dry run, not executing command: " + execCommand)
+			step.Actions = append(step.Actions, StepAction{Kind: "exec", Content: execCommand, Pane: pane, DryRun: true})
+			continue
+		}
+
 		isSafe := false
 		command := execCommand
 		if m.GetExecConfirm() {
-			isSafe, command = m.confirmedToExec(execCommand, "Execute this command?", true)
+			isSafe, command = m.confirmedToExec(execCommand, m.panePrompt("Execute this command?", pane), true)
 		} else {
 			isSafe = true
 		}
+		action := StepAction{Kind: "exec", Content: execCommand, Pane: pane, Executed: isSafe}
 		if isSafe {
-			m.Println("Executing command: " + command)
-			if m.ExecPane.IsPrepared {
-				history, err := m.ExecWaitCapture(command)
-				if err != nil {
-					logger.Warn("ExecWaitCapture failed for command '%s': %v", command, err)
-				} else {
-					m.enqueueReflection(history)
-				}
+			// the command as the user edited it
+			action.Content = command
+		}
+		step.Actions = append(step.Actions, action)
+		if isSafe {
+			if pane != "" {
+				m.Println("Executing command in pane " + pane + ": " + command)
 			} else {
-				_ = system.TmuxSendCommandToPane(m.ExecPane.Id, command, true)
-				time.Sleep(1 * time.Second)
+				m.Println("Executing command: " + command)
 			}
+			_, _ = m.execInPane(ctx, request, pane, command)
 		} else {
 			m.Status = ""
-			return false
+			step.Outcome = StepDeclined
+			return ""
 		}
 	}
 
 	// Process SendKeys
 	if len(r.SendKeys) > 0 {
+		keys, allowed := m.preSendKeysHook(ctx, request, target, r.SendKeys)
+		if !allowed {
+			for _, sendKey := range r.SendKeys {
+				step.Actions = append(step.Actions, StepAction{Kind: "send_keys", Content: sendKey, Pane: pane})
+			}
+			m.Status = ""
+			step.Outcome = StepVetoed
+			return ""
+		}
+		r.SendKeys = keys
+
 		// Show preview of all keys
 		keysPreview := "Keys to send:\n"
+		if pane != "" {
+			keysPreview = "Keys to send to pane " + pane + ":\n"
+		}
 		for i, sendKey := range r.SendKeys {
 			code, _ := system.HighlightCode("txt", sendKey)
 			if i == len(r.SendKeys)-1 {
@@ -204,44 +345,46 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 				keysPreview += code + "\n"
 			}
 			if m.Status == "" {
-				return false
+				step.Outcome = StepCanceled
+				return ""
 			}
 		}
 
 		m.Println(keysPreview)
 
-		// Determine confirmation message based on number of keys
-		confirmMessage := "Send this key?"
-		if len(r.SendKeys) > 1 {
-			confirmMessage = "Send all these keys?"
-		}
-
-		// Get confirmation if required
-		var allConfirmed bool
-		if m.GetSendKeysConfirm() {
-			allConfirmed, _ = m.confirmedToExec("keys shown above", confirmMessage, true)
-			if !allConfirmed {
-				m.Status = ""
-				return false
+		if m.DryRun {
+			m.Println("Dry run, not sending keys.")
+			for _, sendKey := range r.SendKeys {
+				step.Actions = append(step.Actions, StepAction{Kind: "send_keys", Content: sendKey, Pane: pane, DryRun: true})
+			}
+		} else {
+			// Determine confirmation message based on number of keys
+			confirmMessage := "Send this key?"
+			if len(r.SendKeys) > 1 {
+				confirmMessage = "Send all these keys?"
 			}
-		}
 
-		// Send each key with delay
-		for _, sendKey := range r.SendKeys {
-			m.Println("Sending keys: " + sendKey)
-			_ = system.TmuxSendCommandToPane(m.ExecPane.Id, sendKey, false)
-			time.Sleep(1 * time.Second)
-		}
-	}
+			// Get confirmation if required
+			var allConfirmed bool
+			if m.GetSendKeysConfirm() {
+				allConfirmed, _ = m.confirmedToExec("keys shown above", m.panePrompt(confirmMessage, pane), true)
+				if !allConfirmed {
+					for _, sendKey := range r.SendKeys {
+						step.Actions = append(step.Actions, StepAction{Kind: "send_keys", Content: sendKey, Pane: pane})
+					}
+					m.Status = ""
+					step.Outcome = StepDeclined
+					return ""
+				}
+			}
 
-	if r.ExecPaneSeemsBusy {
-		m.Countdown(m.GetWaitInterval())
-		// Create a new context for this recursive call
-		newCtx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		accomplished := m.ProcessUserMessage(newCtx, "waited for 5 more seconds, here is the current pane(s) content")
-		if accomplished {
-			return true
+			// Send each key with delay
+			for _, sendKey := range r.SendKeys {
+				step.Actions = append(step.Actions, StepAction{Kind: "send_keys", Content: sendKey, Pane: pane, Executed: true})
+				m.Println("Sending keys: " + sendKey)
+				_ = system.TmuxSendCommandToPane(target, sendKey, false)
+				time.Sleep(1 * time.Second)
+			}
 		}
 	}
 
@@ -250,69 +393,127 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		code, _ := system.HighlightCode("txt", r.PasteMultilineContent)
 		fmt.Println(code)
 
-		isSafe := false
-		if m.GetPasteMultilineConfirm() {
-			isSafe, _ = m.confirmedToExec(r.PasteMultilineContent, "Paste multiline content?", false)
+		if m.DryRun {
+			m.Println("Dry run, not pasting.")
+			step.Actions = append(step.Actions, StepAction{Kind: "paste", Content: r.PasteMultilineContent, Pane: pane, DryRun: true})
 		} else {
-			isSafe = true
-		}
+			isSafe := false
+			if m.GetPasteMultilineConfirm() {
+				isSafe, _ = m.confirmedToExec(r.PasteMultilineContent, m.panePrompt("Paste multiline content?", pane), false)
+			} else {
+				isSafe = true
+			}
 
-		if isSafe {
-			m.Println("Pasting...")
-			_ = system.TmuxSendCommandToPane(m.ExecPane.Id, r.PasteMultilineContent, true)
-			time.Sleep(1 * time.Second)
-		} else {
-			m.Status = ""
-			return false
+			step.Actions = append(step.Actions, StepAction{Kind: "paste", Content: r.PasteMultilineContent, Pane: pane, Executed: isSafe})
+			if isSafe {
+				m.Println("Pasting...")
+				_ = system.TmuxSendCommandToPane(target, r.PasteMultilineContent, true)
+				time.Sleep(1 * time.Second)
+			} else {
+				m.Status = ""
+				step.Outcome = StepDeclined
+				return ""
+			}
 		}
 	}
 
+	if r.ExecPaneSeemsBusy {
+		m.Countdown(m.GetWaitInterval())
+		step.Outcome = StepBusy
+		return fmt.Sprintf("waited for %d more seconds, here is the current pane(s) content", m.GetWaitInterval())
+	}
+
 	if r.RequestAccomplished {
 		m.Status = ""
-		return true
+		step.Outcome = StepAccomplished
+		return ""
 	}
 
 	if r.WaitingForUserResponse {
 		m.Status = "waiting"
-		return false
+		step.Outcome = StepWaitingForUser
+		return ""
 	}
 
 	// watch mode only
 	if r.NoComment {
-		return false
+		step.Outcome = StepNoComment
+		return ""
 	}
 
-	if !m.WatchMode {
-		accomplished := m.ProcessUserMessage(ctx, "sending updated pane(s) content")
-		if accomplished {
-			return true
-		}
+	// Watch mode looks at the panes again on its own schedule, see startWatchMode
+	if m.WatchMode {
+		step.Outcome = StepCommented
+		return ""
 	}
-	return false
+
+	step.Outcome = StepContinue
+	if m.DryRun {
+		return dryRunObservation(step.Actions)
+	}
+	return "sending updated pane(s) content"
 }
 
-func (m *Manager) startWatchMode(desc string) {
+// composeHistory builds what is sent for a user message: the system prompt, the loaded
+// knowledge bases and the chat history, then the message itself with the current pane contents
+func (m *Manager) composeHistory(message string) ([]ChatMessage, ChatMessage) {
+	currentTmuxWindow := m.getTmuxPanesInXml(m.Config)
+	execPaneEnv := ""
+	if !m.ExecPane.IsSubShell {
+		execPaneEnv = fmt.Sprintf("Keep in mind, you are working within the shell: %s and OS: %s", m.ExecPane.Shell, m.ExecPane.OS)
+	}
+	currentMessage := ChatMessage{
+		Content:   currentTmuxWindow + "\n\n" + execPaneEnv + "\n\n" + message,
+		FromUser:  true,
+		Timestamp: time.Now(),
+	}
+
+	// build current chat history
+	var history []ChatMessage
+	switch {
+	case m.WatchMode:
+		history = []ChatMessage{m.watchPrompt()}
+	case m.ExecPane.IsPrepared:
+		history = []ChatMessage{m.chatAssistantPrompt(true)}
+	default:
+		history = []ChatMessage{m.chatAssistantPrompt(false)}
+	}
 
-	// check status
-	if m.Status == "" {
-		return
+	// Inject loaded knowledge bases after system prompt
+	for kbName, kbContent := range m.LoadedKBs {
+		history = append(history, ChatMessage{
+			Content:   fmt.Sprintf("=== Knowledge Base: %s ===\n%s", kbName, kbContent),
+			FromUser:  false,
+			Timestamp: time.Now(),
+		})
 	}
 
-	m.Countdown(m.GetWaitInterval())
+	history = append(history, m.Messages...)
+	return history, currentMessage
+}
 
-	// Create a new background context since this is a separate process
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// showReasoning reports whether the model of a role is configured to have its reasoning summarized
+func (m *Manager) showReasoning(role string) bool {
+	modelConfig, exists := m.GetModelConfig(m.GetRoleModel(role))
+	return exists && modelConfig.ReasoningSummary != ""
+}
 
-	accomplished := m.ProcessUserMessage(ctx, desc)
-	if accomplished {
-		m.WatchMode = false
-		m.Status = ""
-	}
+func (m *Manager) startWatchMode(ctx context.Context, desc string) {
+	// we continue running while status is still set
+	for m.Status != "" && m.WatchMode {
+		if ctx.Err() != nil {
+			m.WatchMode = false
+			m.Status = ""
+			return
+		}
+		m.Countdown(m.GetWaitInterval())
 
-	// we continue running if status is still set
-	if m.Status != "" && m.WatchMode {
-		m.startWatchMode("")
+		accomplished := m.ProcessUserMessage(ctx, desc)
+		if accomplished {
+			m.WatchMode = false
+			m.Status = ""
+		}
+		desc = ""
 	}
 }
 
@@ -354,6 +555,14 @@ func (m *Manager) aiFollowedGuidelines(r AIResponse) (string, bool) {
 		return "You didn't follow the guidelines. You can only use one type of XML tag in your response. Pay attention!", false
 	}
 
+	// all actions target one pane, the exec pane or a writable pane
+	if r.PaneConflict != "" {
+		return fmt.Sprintf("You didn't follow the guidelines. All actions of a response must target the same pane, you targeted %s. Pay attention!", r.PaneConflict), false
+	}
+	if !m.isPaneWritable(r.Pane) {
+		return fmt.Sprintf("You didn't follow the guidelines. Pane %s is a read_only_pane, you can only act in the exec pane and in writable_pane panes. Pay attention!", r.Pane), false
+	}
+
 	// watch mode has no xml tags, otherwise should be at least 1 xml tag in response
 	if !m.WatchMode && count+boolCount == 0 {
 		return "You didn't follow the guidelines. You must use at least one XML tag in your response. Pay attention!", false
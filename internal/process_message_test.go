@@ -8,6 +8,7 @@ import (
 	"github.com/alvinunreal/tmuxai/system"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockAiClient is a mock implementation of AiClientInterface for testing
@@ -459,3 +460,126 @@ func TestProcessUserMessage_WatchModeNoComment(t *testing.T) {
 	_, valid3 := manager.aiFollowedGuidelines(response3)
 	assert.False(t, valid3, "Empty response (no flags, no XML tags) should fail validation when not in watch mode")
 }
+
+func newLoopTestManager(responses ...string) (*Manager, *MockAiClient) {
+	mockAiClient := &MockAiClient{}
+	for _, response := range responses {
+		mockAiClient.On("GetResponseFromChatMessages", mock.Anything, mock.Anything, mock.Anything).Return(response, nil).Once()
+	}
+	manager := &Manager{
+		Config:           &config.Config{MaxContextSize: 1000000, OpenRouter: config.OpenRouterConfig{APIKey: "key"}},
+		SessionOverrides: make(map[string]interface{}),
+		Status:           "running",
+		AiClient:         mockAiClient,
+		ExecPane:         &system.TmuxPaneDetails{},
+	}
+	manager.getTmuxPanesInXml = func(config *config.Config) string {
+		return "<tmux>mock pane content</tmux>"
+	}
+	return manager, mockAiClient
+}
+
+// Test: The agent loop stops once max_steps is used up, waiting on a busy pane doesn't count
+func TestProcessUserMessage_MaxSteps(t *testing.T) {
+	busy := "<ExecPaneSeemsBusy>1</ExecPaneSeemsBusy>"
+	manager, mockAiClient := newLoopTestManager(busy, busy, busy, "<ExecCommand>make</ExecCommand>", "<ExecCommand>make test</ExecCommand>", busy)
+	manager.SessionOverrides["max_steps"] = 2
+	manager.SessionOverrides["wait_interval"] = 0
+	sent := captureSent(t)
+
+	assert.False(t, manager.ProcessUserMessage(context.Background(), "build the project"))
+	mockAiClient.AssertNumberOfCalls(t, "GetResponseFromChatMessages", 5)
+	assert.Equal(t, "", manager.Status)
+	assert.Equal(t, []string{"make", "make test"}, *sent)
+
+	outcomes := make([]StepOutcome, len(manager.Trace))
+	for i, step := range manager.Trace {
+		outcomes[i] = step.Outcome
+	}
+	assert.Equal(t, []StepOutcome{StepBusy, StepBusy, StepBusy, StepContinue, StepBudgetExceeded}, outcomes)
+	assert.Equal(t, "build the project", manager.Trace[0].Request)
+	assert.True(t, manager.Trace[1].Response.ExecPaneSeemsBusy)
+	assert.ErrorContains(t, manager.Trace[4].Err, "max_steps")
+}
+
+// Test: A pane that stays busy stops the loop once max_busy_waits is used up
+func TestProcessUserMessage_MaxBusyWaits(t *testing.T) {
+	manager, mockAiClient := newLoopTestManager()
+	mockAiClient.On("GetResponseFromChatMessages", mock.Anything, mock.Anything, mock.Anything).Return("<ExecPaneSeemsBusy>1</ExecPaneSeemsBusy>", nil)
+	manager.SessionOverrides["max_busy_waits"] = 4
+	manager.SessionOverrides["wait_interval"] = 0
+
+	assert.False(t, manager.ProcessUserMessage(context.Background(), "tail the log"))
+	mockAiClient.AssertNumberOfCalls(t, "GetResponseFromChatMessages", 4)
+	require.Len(t, manager.Trace, 4)
+	assert.Equal(t, StepBudgetExceeded, manager.Trace[3].Outcome)
+	assert.ErrorContains(t, manager.Trace[3].Err, "max_busy_waits")
+}
+
+// Test: Guideline retries are capped by max_retries
+func TestProcessUserMessage_MaxRetries(t *testing.T) {
+	manager, mockAiClient := newLoopTestManager("no tags", "no tags", "no tags", "no tags")
+	manager.SessionOverrides["max_retries"] = 2
+
+	assert.False(t, manager.ProcessUserMessage(context.Background(), "hello"))
+	mockAiClient.AssertNumberOfCalls(t, "GetResponseFromChatMessages", 3)
+	require.Len(t, manager.Trace, 3)
+	assert.Equal(t, StepRetry, manager.Trace[1].Outcome)
+	assert.Contains(t, manager.Trace[1].Request, "You didn't follow the guidelines")
+	assert.Equal(t, StepBudgetExceeded, manager.Trace[2].Outcome)
+	assert.ErrorContains(t, manager.Trace[2].Err, "max_retries")
+}
+
+// Test: Declined actions end the loop and are kept in the trace
+func TestProcessUserMessage_TraceActions(t *testing.T) {
+	manager, _ := newLoopTestManager("Let me check.\n<ExecCommand>df -h</ExecCommand>")
+	manager.Config.ExecConfirm = true
+	manager.confirmedToExec = func(command string, prompt string, edit bool) (bool, string) {
+		return false, ""
+	}
+
+	assert.False(t, manager.ProcessUserMessage(context.Background(), "why is the disk full?"))
+	require.Len(t, manager.Trace, 1)
+	step := manager.Trace[0]
+	assert.Equal(t, StepDeclined, step.Outcome)
+	assert.Equal(t, []StepAction{{Kind: "exec", Content: "df -h", Executed: false}}, step.Actions)
+	assert.Equal(t, "Let me check.", step.Response.Message)
+	assert.Contains(t, step.String(), "exec(df -h) declined")
+}
+
+// Test: A dry run shows the actions without sending them and tells the AI they did not run
+func TestProcessUserMessage_DryRun(t *testing.T) {
+	manager, mockAiClient := newLoopTestManager(
+		"<ExecCommand>rm -rf build</ExecCommand>",
+		"<TmuxSendKeys>q</TmuxSendKeys>",
+		"<PasteMultilineContent>line one\nline two</PasteMultilineContent>",
+		"<RequestAccomplished>1</RequestAccomplished>",
+	)
+	manager.DryRun = true
+	manager.Config.ExecConfirm = true
+	manager.Config.SendKeysConfirm = true
+	manager.confirmedToExec = func(command string, prompt string, edit bool) (bool, string) {
+		t.Errorf("nothing should be confirmed in a dry run, asked for %q", command)
+		return false, ""
+	}
+
+	originalSend := system.TmuxSendCommandToPane
+	defer func() { system.TmuxSendCommandToPane = originalSend }()
+	system.TmuxSendCommandToPane = func(paneId string, command string, enter bool) error {
+		t.Errorf("nothing should be sent to the panes in a dry run, sent %q", command)
+		return nil
+	}
+
+	assert.True(t, manager.ProcessUserMessage(context.Background(), "clean the build"))
+	mockAiClient.AssertNumberOfCalls(t, "GetResponseFromChatMessages", 4)
+
+	require.Len(t, manager.Trace, 4)
+	assert.Equal(t, []StepAction{{Kind: "exec", Content: "rm -rf build", DryRun: true}}, manager.Trace[0].Actions)
+	assert.Equal(t, StepContinue, manager.Trace[0].Outcome)
+	assert.Contains(t, manager.Trace[0].String(), "exec(rm -rf build) dry run")
+	assert.Equal(t, []StepAction{{Kind: "send_keys", Content: "q", DryRun: true}}, manager.Trace[1].Actions)
+	assert.Equal(t, "paste", manager.Trace[2].Actions[0].Kind)
+
+	assert.Contains(t, manager.Trace[1].Request, "<ExecCommand>rm -rf build</ExecCommand>: not executed (dry run)")
+	assert.Contains(t, manager.Trace[2].Request, "<TmuxSendKeys>q</TmuxSendKeys>: not executed (dry run)")
+}
@@ -1,10 +1,13 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
 	"html"
 	"regexp"
 	"strings"
+
+	"github.com/alvinunreal/tmuxai/logger"
 )
 
 func (m *Manager) parseAIResponse(response string) (AIResponse, error) {
@@ -26,21 +29,24 @@ func (m *Manager) parseAIResponse(response string) (AIResponse, error) {
 	}
 
 	clean := response
-	tagPattern := `(?s)<%s>(.*?)</%s>`
+	// Tags may carry attributes, e.g. <ExecCommand pane="%2">
+	tagPattern := `(?s)<%s(\s[^>]*)?>(.*?)</%s>`
 	r := AIResponse{}
 	cleanForMsg := clean
+	var panes []string // pane attribute of each action tag, empty for the exec pane
 	for _, t := range tags {
 		reTag := regexp.MustCompile(fmt.Sprintf(tagPattern, t.name, t.name))
 		tagMatches := reTag.FindAllStringSubmatch(clean, -1)
 		for _, m := range tagMatches {
-			// m[0] is the full match, m[1] is the value
-			if len(m) < 2 {
+			// m[0] is the full match, m[1] the attributes, m[2] is the value
+			if len(m) < 3 {
 				continue // skip invalid match
 			}
-			val := strings.TrimSpace(m[1])
+			val := strings.TrimSpace(m[2])
 			// Decode XML entities for non-bool tags
 			if !t.isBool {
 				val = html.UnescapeString(val)
+				panes = append(panes, paneAttribute(m[1]))
 			}
 			if t.isArray {
 				t.setField(&r, val)
@@ -50,13 +56,24 @@ func (m *Manager) parseAIResponse(response string) (AIResponse, error) {
 		}
 		// For message: remove all tag blocks, including code/backtick wrappers
 		// Remove code block: ```xml\n<tag>...</tag>\n```, ```\n<tag>...</tag>\n```
-		cleanForMsg = regexp.MustCompile(fmt.Sprintf("(?s)```(?:xml)?\\s*<%s>.*?</%s>\\s*```", t.name, t.name)).ReplaceAllString(cleanForMsg, "")
+		cleanForMsg = regexp.MustCompile(fmt.Sprintf("(?s)```(?:xml)?\\s*<%s(?:\\s[^>]*)?>.*?</%s>\\s*```", t.name, t.name)).ReplaceAllString(cleanForMsg, "")
 		// Remove single backtick-wrapped tags: `<Tag>...</Tag>`
-		cleanForMsg = regexp.MustCompile(fmt.Sprintf("`<%s>.*?</%s>`", t.name, t.name)).ReplaceAllString(cleanForMsg, "")
+		cleanForMsg = regexp.MustCompile(fmt.Sprintf("`<%s(?:\\s[^>]*)?>.*?</%s>`", t.name, t.name)).ReplaceAllString(cleanForMsg, "")
 		// Remove plain tag: <Tag>...</Tag>
 		cleanForMsg = reTag.ReplaceAllString(cleanForMsg, "")
 	}
 
+	// All actions of a response go to one pane, the AI is asked again otherwise
+	for _, pane := range panes {
+		if pane != panes[0] {
+			r.PaneConflict = fmt.Sprintf("%s and %s", paneName(panes[0]), paneName(pane))
+			break
+		}
+	}
+	if len(panes) > 0 {
+		r.Pane = panes[0]
+	}
+
 	// Special handling: tags that may appear as <TagName> or ```<TagName>``` (no value)
 	// Set bool fields to true if such tag is present, even if no value
 	for _, t := range tags {
@@ -85,6 +102,104 @@ func (m *Manager) parseAIResponse(response string) (AIResponse, error) {
 	return r, nil
 }
 
+var paneAttributeRegex = regexp.MustCompile(`\bpane\s*=\s*["']([^"']*)["']`)
+
+// paneAttribute returns the pane="%N" attribute of a tag, empty when there is none
+func paneAttribute(attributes string) string {
+	if match := paneAttributeRegex.FindStringSubmatch(attributes); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return ""
+}
+
+// paneName names a pane target for messages, empty is the exec pane
+func paneName(pane string) string {
+	if pane == "" {
+		return "the exec pane"
+	}
+	return "pane " + pane
+}
+
+// toolCallArguments holds the arguments of any of the action tools
+type toolCallArguments struct {
+	Keys    []string `json:"keys"`
+	Command string   `json:"command"`
+	Content string   `json:"content"`
+	Pane    string   `json:"pane"`
+}
+
+// applyToolCalls maps native tool calls onto the response, the same way parseAIResponse maps XML tags
+func applyToolCalls(r *AIResponse, calls []ToolCall) error {
+	for _, call := range calls {
+		var args toolCallArguments
+		if strings.TrimSpace(call.Function.Arguments) != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+				return fmt.Errorf("invalid arguments for tool %s: %w", call.Function.Name, err)
+			}
+		}
+
+		switch call.Function.Name {
+		case "TmuxSendKeys", "ExecCommand", "PasteMultilineContent":
+			hasActions := len(r.SendKeys)+len(r.ExecCommand) > 0 || r.PasteMultilineContent != ""
+			if hasActions && args.Pane != r.Pane {
+				if r.PaneConflict == "" {
+					r.PaneConflict = fmt.Sprintf("%s and %s", paneName(r.Pane), paneName(args.Pane))
+				}
+			} else {
+				r.Pane = args.Pane
+			}
+		}
+
+		switch call.Function.Name {
+		case "TmuxSendKeys":
+			r.SendKeys = append(r.SendKeys, args.Keys...)
+		case "ExecCommand":
+			r.ExecCommand = append(r.ExecCommand, args.Command)
+		case "PasteMultilineContent":
+			r.PasteMultilineContent = args.Content
+		case "RequestAccomplished":
+			r.RequestAccomplished = true
+		case "ExecPaneSeemsBusy":
+			r.ExecPaneSeemsBusy = true
+		case "WaitingForUserResponse":
+			r.WaitingForUserResponse = true
+		case "NoComment":
+			r.NoComment = true
+		default:
+			logger.Warn("Ignoring call to unknown tool: %s", call.Function.Name)
+		}
+	}
+	return nil
+}
+
+// toolCallsToXML renders tool calls as the equivalent XML tags, which is how they are kept in the chat history
+func toolCallsToXML(calls []ToolCall) string {
+	var sb strings.Builder
+	for _, call := range calls {
+		var args toolCallArguments
+		_ = json.Unmarshal([]byte(call.Function.Arguments), &args)
+
+		name := call.Function.Name
+		attributes := ""
+		if args.Pane != "" {
+			attributes = fmt.Sprintf(" pane=\"%s\"", html.EscapeString(args.Pane))
+		}
+		switch name {
+		case "TmuxSendKeys":
+			for _, key := range args.Keys {
+				fmt.Fprintf(&sb, "<%s%s>%s</%s>\n", name, attributes, html.EscapeString(key), name)
+			}
+		case "ExecCommand":
+			fmt.Fprintf(&sb, "<%s%s>%s</%s>\n", name, attributes, html.EscapeString(args.Command), name)
+		case "PasteMultilineContent":
+			fmt.Fprintf(&sb, "<%s%s>%s</%s>\n", name, attributes, html.EscapeString(args.Content), name)
+		case "RequestAccomplished", "ExecPaneSeemsBusy", "WaitingForUserResponse", "NoComment":
+			fmt.Fprintf(&sb, "<%s>1</%s>\n", name, name)
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
 // Helper: check if string is "1" or "true" (case-insensitive)
 func isTrue(s string) bool {
 	s = strings.TrimSpace(strings.ToLower(s))
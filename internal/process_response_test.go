@@ -3,7 +3,10 @@ package internal
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/alvinunreal/tmuxai/system"
 )
 
 // Test: Single tag, inline
@@ -253,3 +256,37 @@ func TestParseAIResponse_MixedAIAndNonAIXMLTags(t *testing.T) {
 		t.Errorf("got %+v, want %+v", got, want)
 	}
 }
+
+// Test: Action tags target another pane with the pane attribute
+func TestParseAIResponse_PaneAttribute(t *testing.T) {
+	m := &Manager{}
+	input := "Running the tests in the other pane.\n<ExecCommand pane=\"%3\">make test</ExecCommand>\n<ExecCommand pane='%3'>make lint</ExecCommand>"
+	want := AIResponse{
+		Message:     "Running the tests in the other pane.",
+		ExecCommand: []string{"make test", "make lint"},
+		Pane:        "%3",
+	}
+	got, err := m.parseAIResponse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// Test: Actions of one response split across panes are parsed, the AI is asked again for them
+func TestParseAIResponse_PaneAttributeConflict(t *testing.T) {
+	m := &Manager{ExecPane: &system.TmuxPaneDetails{Id: "%1"}}
+	input := "<TmuxSendKeys pane=\"%3\">q</TmuxSendKeys>\n<TmuxSendKeys>Enter</TmuxSendKeys>"
+	got, err := m.parseAIResponse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.PaneConflict != "pane %3 and the exec pane" {
+		t.Errorf("got pane conflict %q", got.PaneConflict)
+	}
+	if guidelineError, valid := m.aiFollowedGuidelines(got); valid || !strings.Contains(guidelineError, "must target the same pane") {
+		t.Errorf("expected a guideline retry, got %q", guidelineError)
+	}
+}
@@ -8,6 +8,10 @@ import (
 	"github.com/alvinunreal/tmuxai/logger"
 )
 
+// nativeToolsPrompt tells models configured for native tool calling to call tools instead of writing tags
+const nativeToolsPrompt = "\nThe XML tags above are also available to you as function tools with the same names. " +
+	"Call the tools instead of writing the XML tags in your response.\n"
+
 func (m *Manager) baseSystemPrompt(personaName string) string {
 	var basePrompt string
 
@@ -150,6 +154,16 @@ func (m *Manager) chatAssistantPrompt(prepared bool) ChatMessage {
 
 	builder.WriteString("</examples_of_responses>\n")
 
+	if m.hasWritablePanes() {
+		builder.WriteString("\nBesides the exec pane you can act in the panes titled writable_pane. " +
+			"To target one, add its id as the pane attribute of ExecCommand, TmuxSendKeys or PasteMultilineContent, for example <ExecCommand pane=\"%2\">make test</ExecCommand>. " +
+			"Without the attribute actions go to the exec pane. All actions of a response must target the same pane, and you can never act in a read_only_pane.\n")
+	}
+
+	if m.useNativeTools() {
+		builder.WriteString(nativeToolsPrompt)
+	}
+
 	// Custom additional prompt
 	if m.Config.Prompts.ChatAssistant != "" {
 		builder.WriteString(m.Config.Prompts.ChatAssistant)
@@ -174,6 +188,10 @@ func (m *Manager) watchPrompt() ChatMessage {
 		"If no response is needed, output:\n"+
 		"<NoComment>1</NoComment>\n", basePrompt)
 
+	if m.useNativeTools() {
+		chatPrompt += nativeToolsPrompt
+	}
+
 	if m.Config.Prompts.Watch != "" {
 		chatPrompt = chatPrompt + "\n\n" + m.Config.Prompts.Watch
 	}
@@ -184,3 +202,29 @@ func (m *Manager) watchPrompt() ChatMessage {
 		FromUser:  false,
 	}
 }
+
+func (m *Manager) planPrompt() ChatMessage {
+	logger.Debug("Using current persona for plan prompt: %s", m.CurrentPersona)
+	basePrompt := m.baseSystemPrompt("")
+	planPrompt := fmt.Sprintf("%s\n"+
+		"You are currently planning a task before anything is executed.\n"+
+		"Analyze the user's request and the current tmux pane(s) content, then break the task down into a short, numbered plan.\n"+
+		"Each step of the plan is exactly one shell command, run in the exec pane after the user approves the plan.\n"+
+		"Write each step as a PlanStep tag with a short description and the command:\n\n"+
+		"<PlanStep>\n"+
+		"<Description>Install the dependencies</Description>\n"+
+		"<Command>npm install</Command>\n"+
+		"</PlanStep>\n\n"+
+		"Keep the steps in the order they must run, keep commands short and never ask the user anything in a command.\n"+
+		"Do not use any other XML tag. You may write one or two sentences about the plan before the steps.\n", basePrompt)
+
+	if m.Config.Prompts.Plan != "" {
+		planPrompt = planPrompt + "\n\n" + m.Config.Prompts.Plan
+	}
+
+	return ChatMessage{
+		Content:   planPrompt,
+		Timestamp: time.Now(),
+		FromUser:  false,
+	}
+}
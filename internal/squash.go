@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/alvinunreal/tmuxai/logger"
-	"github.com/alvinunreal/tmuxai/system"
 	"github.com/briandowns/spinner"
 )
 
@@ -15,7 +14,7 @@ import (
 func (m *Manager) needSquash() bool {
 	totalTokens := 0
 	for _, msg := range m.Messages {
-		totalTokens += system.EstimateTokenCount(msg.Content)
+		totalTokens += m.countTokens(msg.Content)
 	}
 
 	threshold := int(float64(m.GetMaxContextSize()) * 0.8)
@@ -85,6 +84,8 @@ func (m *Manager) squashHistory() {
 		})
 
 		m.Messages = newHistory
+		m.usageTracker().ResetLast()
+		m.resetResponseChain()
 		logger.Debug("Context successfully reduced through summarization")
 	}
 }
@@ -92,6 +93,7 @@ func (m *Manager) squashHistory() {
 // summarizeChatHistory asks the AI to summarize the chat history
 func (m *Manager) summarizeChatHistory(messages []ChatMessage) (string, error) {
 	s := spinner.New(spinner.CharSets[26], 100*time.Millisecond)
+	m.showRetries(s)
 	s.Start()
 
 	// Convert messages to a readable format for summarization
@@ -121,9 +123,9 @@ func (m *Manager) summarizeChatHistory(messages []ChatMessage) (string, error) {
 	}
 
 	// Create a context for the summarization request (no timeout to support local LLMs with large contexts)
-	ctx := context.Background()
+	ctx := withModelRole(context.Background(), RoleSummarize)
 
-	summary, err := m.AiClient.GetResponseFromChatMessages(ctx, summarizationMessage, m.GetOpenRouterModel())
+	summary, err := m.AiClient.GetResponseFromChatMessages(ctx, summarizationMessage, m.GetModel())
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,291 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/fatih/color"
+)
+
+// reasoningColor dims reasoning summaries so they stand apart from the answer
+var reasoningColor = color.New(color.Faint)
+
+// responseTagNames lists the XML tags the AI uses to request actions.
+// They are hidden while streaming and only acted upon once parseAIResponse sees the full response.
+var responseTagNames = []string{
+	"TmuxSendKeys",
+	"ExecCommand",
+	"PasteMultilineContent",
+	"RequestAccomplished",
+	"ExecPaneSeemsBusy",
+	"WaitingForUserResponse",
+	"NoComment",
+}
+
+// streamIdleFlush is how long an incomplete line waits for more output before it is printed
+const streamIdleFlush = 150 * time.Millisecond
+
+// streamPrinter renders streamed model output as it arrives.
+// Text is printed through system.Cosmetics as soon as a line is complete, or once the stream
+// has been idle for a moment. Code blocks are held back until they are closed so they can be
+// highlighted as a whole, and action tags are left out, so only text that can't be part of
+// either is printed before its line is complete.
+// Reasoning summaries received before the message are printed dimmed above it.
+type streamPrinter struct {
+	mu        sync.Mutex      // Write and Flush race with the idle timer
+	pending   strings.Builder // incomplete line
+	shown     int             // bytes of the incomplete line already printed
+	idle      time.Duration
+	timer     *time.Timer
+	block     strings.Builder // code block being collected
+	inBlock   bool
+	openTag   string // action tag whose closing tag has not arrived yet
+	printed   bool
+	reasoning strings.Builder // incomplete line of reasoning
+	reasoned  bool            // reasoning has been printed and not yet separated from the message
+	started   bool
+	onFirst   func() // called before anything is printed, e.g. to stop the spinner
+	print     func(s string)
+}
+
+func newStreamPrinter(onFirst func()) *streamPrinter {
+	return &streamPrinter{
+		onFirst: onFirst,
+		idle:    streamIdleFlush,
+		print:   func(s string) { fmt.Print(s) },
+	}
+}
+
+// Write receives a delta of the model output
+func (p *streamPrinter) Write(delta string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending.WriteString(delta)
+	buffered := p.pending.String()
+	if idx := strings.LastIndex(buffered, "\n"); idx >= 0 {
+		p.pending.Reset()
+		p.pending.WriteString(buffered[idx+1:])
+		for _, line := range strings.Split(buffered[:idx], "\n") {
+			p.line(line)
+		}
+	}
+	if p.pending.Len() > 0 {
+		p.waitIdle()
+	}
+}
+
+// waitIdle (re)starts the timer that prints the incomplete line when no more output arrives
+func (p *streamPrinter) waitIdle() {
+	if p.timer == nil {
+		p.timer = time.AfterFunc(p.idle, p.flushPartial)
+		return
+	}
+	p.timer.Reset(p.idle)
+}
+
+// flushPartial prints the part of the incomplete line that can't turn into a code block or an action tag
+func (p *streamPrinter) flushPartial() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inBlock || p.openTag != "" {
+		return
+	}
+	line := p.pending.String()
+	if p.shown == 0 {
+		// The line may still become the fence of a code block
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "```") || strings.HasPrefix("```", trimmed) {
+			return
+		}
+	}
+
+	text := line[p.shown:]
+	// An action tag may be arriving, keep everything from its opening bracket
+	if idx := strings.Index(text, "<"); idx >= 0 {
+		text = text[:idx]
+	}
+	// Inline code is only highlighted once its closing backtick has arrived
+	if strings.Count(text, "`")%2 == 1 {
+		text = text[:strings.LastIndex(text, "`")]
+	}
+	if text == "" {
+		return
+	}
+	p.shown += len(text)
+	p.emit(text)
+}
+
+// Reason receives a delta of the model's reasoning summary
+func (p *streamPrinter) Reason(delta string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.printed {
+		// Never mix reasoning into a message that is already being shown
+		return
+	}
+	p.reasoning.WriteString(delta)
+	buffered := p.reasoning.String()
+	idx := strings.LastIndex(buffered, "\n")
+	if idx < 0 {
+		return
+	}
+	p.reasoning.Reset()
+	p.reasoning.WriteString(buffered[idx+1:])
+	p.dim(buffered[:idx+1])
+}
+
+// endReasoning prints the rest of the reasoning and separates it from what follows
+func (p *streamPrinter) endReasoning() {
+	if p.reasoning.Len() > 0 {
+		rest := p.reasoning.String()
+		p.reasoning.Reset()
+		if strings.TrimSpace(rest) != "" {
+			p.dim(rest + "\n")
+		}
+	}
+	if p.reasoned {
+		p.reasoned = false
+		p.print("\n")
+	}
+}
+
+func (p *streamPrinter) dim(text string) {
+	p.start()
+	p.reasoned = true
+	p.print(reasoningColor.Sprint(text))
+}
+
+// Flush prints whatever is left once the stream has ended
+func (p *streamPrinter) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.endReasoning()
+	if p.pending.Len() > 0 {
+		line := p.pending.String()
+		p.pending.Reset()
+		p.line(line)
+	}
+	if p.inBlock {
+		p.inBlock = false
+		if !containsResponseTag(p.block.String()) {
+			p.emit(p.block.String())
+		}
+		p.block.Reset()
+	}
+}
+
+// Printed reports whether any part of the message has been shown to the user
+func (p *streamPrinter) Printed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.printed
+}
+
+func (p *streamPrinter) line(line string) {
+	if p.shown > 0 {
+		// The start of the line has been printed already, it was plain text
+		rest := line[p.shown:]
+		p.shown = 0
+		p.emit(p.stripTags(rest) + "\n")
+		return
+	}
+
+	trimmed := strings.TrimSpace(line)
+
+	if p.openTag == "" && strings.HasPrefix(trimmed, "```") {
+		p.block.WriteString(line + "\n")
+		if p.inBlock || (len(trimmed) > 3 && strings.HasSuffix(trimmed, "```")) {
+			block := p.block.String()
+			p.inBlock = false
+			p.block.Reset()
+			if !containsResponseTag(block) {
+				p.emit(block)
+			}
+			return
+		}
+		p.inBlock = true
+		return
+	}
+	if p.inBlock {
+		p.block.WriteString(line + "\n")
+		return
+	}
+
+	text := p.stripTags(line)
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	p.emit(text + "\n")
+}
+
+// stripTags removes action tags from a line, keeping track of tags spanning several lines
+func (p *streamPrinter) stripTags(line string) string {
+	var out strings.Builder
+	rest := line
+	for rest != "" {
+		if p.openTag != "" {
+			closing := "</" + p.openTag + ">"
+			idx := strings.Index(rest, closing)
+			if idx < 0 {
+				return out.String()
+			}
+			rest = rest[idx+len(closing):]
+			p.openTag = ""
+			continue
+		}
+
+		start, end, name, selfClosing := findResponseTag(rest)
+		if start < 0 {
+			out.WriteString(rest)
+			break
+		}
+		out.WriteString(rest[:start])
+		rest = rest[end:]
+		if !selfClosing {
+			p.openTag = name
+		}
+	}
+	return out.String()
+}
+
+func (p *streamPrinter) emit(text string) {
+	p.endReasoning()
+	p.start()
+	p.printed = true
+	p.print(system.Cosmetics(text))
+}
+
+func (p *streamPrinter) start() {
+	if !p.started && p.onFirst != nil {
+		p.onFirst()
+	}
+	p.started = true
+}
+
+// responseTagRegex matches the opening or self-closing form of an action tag, with or without attributes
+var responseTagRegex = regexp.MustCompile(`<(` + strings.Join(responseTagNames, "|") + `)(?:\s[^>]*?)?(/?)>`)
+
+// findResponseTag returns the position, end and name of the first action tag in s
+func findResponseTag(s string) (int, int, string, bool) {
+	match := responseTagRegex.FindStringSubmatchIndex(s)
+	if match == nil {
+		return -1, -1, "", false
+	}
+	return match[0], match[1], s[match[2]:match[3]], match[5] > match[4]
+}
+
+func containsResponseTag(s string) bool {
+	idx, _, _, _ := findResponseTag(s)
+	return idx >= 0
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStreamPrinter(out *strings.Builder) *streamPrinter {
+	p := newStreamPrinter(nil)
+	p.print = func(s string) { out.WriteString(s) }
+	p.idle = time.Hour // tests call flushPartial themselves
+	return p
+}
+
+func TestStreamPrinter_HidesActionTags(t *testing.T) {
+	var out strings.Builder
+	p := newTestStreamPrinter(&out)
+
+	for _, delta := range []string{"I'll list ", "the files.\n<Exec", "Command>ls -l</ExecCommand>\n"} {
+		p.Write(delta)
+	}
+	p.Flush()
+
+	assert.Equal(t, "I'll list the files.\n", out.String())
+	assert.True(t, p.Printed())
+}
+
+func TestStreamPrinter_InlineTagAndMultilineContent(t *testing.T) {
+	var out strings.Builder
+	p := newTestStreamPrinter(&out)
+
+	p.Write("Pasting now. <PasteMultilineContent>line one\nline two\n")
+	p.Write("</PasteMultilineContent>\n")
+	p.Write("Done")
+	p.Flush()
+
+	assert.Equal(t, "Pasting now. \nDone\n", out.String())
+}
+
+func TestStreamPrinter_TagsWithAttributes(t *testing.T) {
+	var out strings.Builder
+	p := newTestStreamPrinter(&out)
+
+	p.Write("Running the tests.\n<ExecCommand pane=\"%2\">make ")
+	p.Write("test</ExecCommand>\n<TmuxSendKeys pane='%3'/>Sent.\n")
+	p.Flush()
+
+	assert.Equal(t, "Running the tests.\nSent.\n", out.String())
+}
+
+func TestStreamPrinter_CodeBlocks(t *testing.T) {
+	var out strings.Builder
+	p := newTestStreamPrinter(&out)
+
+	p.Write("Wrapped tag:\n```xml\n<RequestAccomplished>1</RequestAccomplished>\n```\n")
+	p.Write("```<ExecPaneSeemsBusy>```\n")
+	p.Flush()
+
+	assert.Equal(t, "Wrapped tag:\n", out.String())
+}
+
+func TestStreamPrinter_NothingPrinted(t *testing.T) {
+	var out strings.Builder
+	p := newTestStreamPrinter(&out)
+
+	p.Write("<WaitingForUserResponse>1</WaitingForUserResponse>")
+	p.Flush()
+
+	assert.Empty(t, out.String())
+	assert.False(t, p.Printed())
+}
+
+func TestStreamPrinter_Reasoning(t *testing.T) {
+	var out strings.Builder
+	p := newTestStreamPrinter(&out)
+
+	p.Reason("Checking the ")
+	p.Reason("disk first.\nThen the logs.")
+	p.Write("Disk is full.\n<ExecCommand>df -h</ExecCommand>")
+	p.Reason("ignored once the message started")
+	p.Flush()
+
+	lines := strings.Split(out.String(), "\n")
+	assert.Contains(t, lines[0], "Checking the disk first.")
+	assert.Contains(t, lines[1], "Then the logs.")
+	assert.Equal(t, "", lines[2])
+	assert.Equal(t, "Disk is full.", lines[3])
+	assert.NotContains(t, out.String(), "ignored")
+	assert.True(t, p.Printed())
+
+	// Reasoning of a response that is not streamed is printed on its own, the message is printed by the caller
+	out.Reset()
+	p = newTestStreamPrinter(&out)
+	p.Reason("Thought about it")
+	p.Flush()
+	assert.Contains(t, out.String(), "Thought about it")
+	assert.False(t, p.Printed())
+}
+
+func TestStreamPrinter_PartialLineWhenIdle(t *testing.T) {
+	var out strings.Builder
+	p := newTestStreamPrinter(&out)
+
+	p.Write("Checking the disk")
+	p.flushPartial()
+	assert.Equal(t, "Checking the disk", out.String())
+	assert.True(t, p.Printed())
+
+	// The rest of the line is printed once, without the tag
+	p.Write(" usage. <ExecCommand>df -h</Exec")
+	p.flushPartial()
+	assert.Equal(t, "Checking the disk usage. ", out.String(), "a tag may be arriving")
+	p.Write("Command>\nDone `df")
+	p.flushPartial()
+	assert.Equal(t, "Checking the disk usage. \nDone ", out.String(), "inline code waits for its closing backtick")
+	p.Flush()
+	assert.Equal(t, "Checking the disk usage. \nDone `df\n", out.String())
+}
+
+func TestStreamPrinter_PartialLineKeepsCodeBlocks(t *testing.T) {
+	var out strings.Builder
+	p := newTestStreamPrinter(&out)
+
+	p.Write("``")
+	p.flushPartial()
+	p.Write("`bash\necho hi")
+	p.flushPartial()
+	assert.Empty(t, out.String())
+
+	p.Write("\n```\n")
+	p.Flush()
+	assert.Contains(t, out.String(), "echo")
+}
+
+func TestStreamPrinter_IdleTimer(t *testing.T) {
+	printed := make(chan string, 1)
+	p := newStreamPrinter(nil)
+	p.print = func(s string) { printed <- s }
+	p.idle = time.Millisecond
+
+	p.Write("Thinking it over")
+	select {
+	case s := <-printed:
+		assert.Equal(t, "Thinking it over", s)
+	case <-time.After(time.Second):
+		t.Fatal("incomplete line was not printed after the stream went idle")
+	}
+	p.Flush()
+	assert.Equal(t, "\n", <-printed)
+}
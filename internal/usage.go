@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// Usage holds the token counts reported by a provider
+type Usage struct {
+	Requests        int
+	InputTokens     int
+	OutputTokens    int
+	ReasoningTokens int     // part of OutputTokens, when the provider reports it
+	Cost            float64 // USD, according to the model pricing
+}
+
+// TotalTokens returns the sum of input and output tokens
+func (u Usage) TotalTokens() int {
+	return u.InputTokens + u.OutputTokens
+}
+
+// Add accumulates other into u
+func (u *Usage) Add(other Usage) {
+	u.Requests += other.Requests
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.ReasoningTokens += other.ReasoningTokens
+	u.Cost += other.Cost
+}
+
+// UsageTracker accumulates token usage for the session, per model and per persona
+type UsageTracker struct {
+	mu        sync.Mutex
+	total     Usage
+	byModel   map[string]*Usage
+	byPersona map[string]*Usage
+	last      *Usage // last chat request, reflects the size of the conversation
+}
+
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{
+		byModel:   make(map[string]*Usage),
+		byPersona: make(map[string]*Usage),
+	}
+}
+
+// Record adds the usage of a request made with the given model configuration and persona
+func (t *UsageTracker) Record(model, persona string, usage Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total.Add(usage)
+	addUsage(t.byModel, model, usage)
+	if persona != "" {
+		addUsage(t.byPersona, persona, usage)
+	}
+}
+
+// SetLast remembers the usage of the last chat request
+func (t *UsageTracker) SetLast(usage Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = &usage
+}
+
+func addUsage(totals map[string]*Usage, key string, usage Usage) {
+	if totals[key] == nil {
+		totals[key] = &Usage{}
+	}
+	totals[key].Add(usage)
+}
+
+// Total returns the usage accumulated over the session
+func (t *UsageTracker) Total() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// Last returns the usage of the last chat request, if any was reported since the history was last reset
+func (t *UsageTracker) Last() (Usage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last == nil {
+		return Usage{}, false
+	}
+	return *t.last, true
+}
+
+// ResetLast forgets the last request, e.g. when the chat history is cleared
+func (t *UsageTracker) ResetLast() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = nil
+}
+
+// ByModel returns the usage per model sorted by name
+func (t *UsageTracker) ByModel() ([]string, map[string]Usage) {
+	return t.snapshot(t.byModel)
+}
+
+// ByPersona returns the usage per persona sorted by name
+func (t *UsageTracker) ByPersona() ([]string, map[string]Usage) {
+	return t.snapshot(t.byPersona)
+}
+
+func (t *UsageTracker) snapshot(totals map[string]*Usage) ([]string, map[string]Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(totals))
+	result := make(map[string]Usage, len(totals))
+	for name, usage := range totals {
+		names = append(names, name)
+		result[name] = *usage
+	}
+	sort.Strings(names)
+	return names, result
+}
+
+type usageKey struct{}
+
+// withUsageCollector returns a context in which providers report usage into collected
+// instead of recording it directly, so that it can be attributed to the model that answered
+func withUsageCollector(ctx context.Context, collected *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, collected)
+}
+
+// recordUsage is called by the providers with the usage reported for a request
+func (c *AiClient) recordUsage(ctx context.Context, model string, usage Usage) {
+	usage.Requests = 1
+	if modelConfig, exists := c.currentModelConfig(ctx); exists {
+		usage.Cost = usageCost(modelConfig, usage)
+	}
+	logger.Debug("Token usage for %s: %d input, %d output, %d reasoning", model, usage.InputTokens, usage.OutputTokens, usage.ReasoningTokens)
+
+	if collected, ok := ctx.Value(usageKey{}).(*Usage); ok {
+		collected.Add(usage)
+		return
+	}
+	if c.configMgr != nil {
+		c.configMgr.recordUsage(model, usage)
+	}
+}
+
+// recordUsage adds the usage of a request to the session totals
+func (m *Manager) recordUsage(model string, usage Usage) {
+	m.usageTracker().Record(model, m.CurrentPersona, usage)
+	if usage.Cost > 0 {
+		m.recordSpend(usage.Cost)
+	}
+}
+
+func (m *Manager) usageTracker() *UsageTracker {
+	if m.Usage == nil {
+		m.Usage = NewUsageTracker()
+	}
+	return m.Usage
+}
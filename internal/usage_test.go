@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func TestUsageTracker(t *testing.T) {
+	tracker := NewUsageTracker()
+	tracker.Record("fast", "default", Usage{Requests: 1, InputTokens: 100, OutputTokens: 20})
+	tracker.Record("smart", "default", Usage{Requests: 1, InputTokens: 50, OutputTokens: 10, ReasoningTokens: 5})
+	tracker.Record("fast", "", Usage{Requests: 1, InputTokens: 1, OutputTokens: 1})
+
+	total := tracker.Total()
+	if total.Requests != 3 || total.InputTokens != 151 || total.OutputTokens != 31 || total.ReasoningTokens != 5 {
+		t.Errorf("unexpected total: %+v", total)
+	}
+
+	models, byModel := tracker.ByModel()
+	if len(models) != 2 || models[0] != "fast" || byModel["fast"].Requests != 2 {
+		t.Errorf("unexpected usage by model: %v %+v", models, byModel)
+	}
+
+	personas, byPersona := tracker.ByPersona()
+	if len(personas) != 1 || byPersona["default"].TotalTokens() != 180 {
+		t.Errorf("unexpected usage by persona: %v %+v", personas, byPersona)
+	}
+
+	if _, ok := tracker.Last(); ok {
+		t.Errorf("expected no last usage before SetLast")
+	}
+	tracker.SetLast(Usage{InputTokens: 10, OutputTokens: 2})
+	if last, ok := tracker.Last(); !ok || last.TotalTokens() != 12 {
+		t.Errorf("unexpected last usage: %+v", last)
+	}
+	tracker.ResetLast()
+	if _, ok := tracker.Last(); ok {
+		t.Errorf("expected last usage to be reset")
+	}
+}
+
+func TestUsageFromProviders(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    string
+		contentType string
+		body        string
+		stream      bool
+		want        Usage
+	}{
+		{
+			name:     "chat completion",
+			provider: "openrouter",
+			body:     `{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15,"completion_tokens_details":{"reasoning_tokens":1}}}`,
+			want:     Usage{Requests: 1, InputTokens: 12, OutputTokens: 3, ReasoningTokens: 1},
+		},
+		{
+			name:        "chat completion stream",
+			provider:    "openrouter",
+			contentType: "text/event-stream",
+			body: "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"}}]}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":7,\"completion_tokens\":2,\"total_tokens\":9}}\n\n" +
+				"data: [DONE]\n\n",
+			stream: true,
+			want:   Usage{Requests: 1, InputTokens: 7, OutputTokens: 2},
+		},
+		{
+			name:     "responses",
+			provider: "openai",
+			body:     `{"output_text":"ok","usage":{"input_tokens":20,"output_tokens":5,"total_tokens":25,"output_tokens_details":{"reasoning_tokens":4}}}`,
+			want:     Usage{Requests: 1, InputTokens: 20, OutputTokens: 5, ReasoningTokens: 4},
+		},
+		{
+			name:        "anthropic stream",
+			provider:    "anthropic",
+			contentType: "text/event-stream",
+			body: "data: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":30,\"output_tokens\":1}}}\n\n" +
+				"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"ok\"}}\n\n" +
+				"data: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":6}}\n\n" +
+				"data: {\"type\":\"message_stop\"}\n\n",
+			stream: true,
+			want:   Usage{Requests: 1, InputTokens: 30, OutputTokens: 6},
+		},
+		{
+			name:     "ollama",
+			provider: "ollama",
+			body:     `{"message":{"role":"assistant","content":"ok"},"done":true,"prompt_eval_count":9,"eval_count":4}`,
+			want:     Usage{Requests: 1, InputTokens: 9, OutputTokens: 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType := tt.contentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				w.Header().Set("Content-Type", contentType)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			manager, client := newTestClient(t, config.ModelConfig{Provider: tt.provider, Model: "test-model", APIKey: "key", BaseURL: server.URL})
+			ctx := context.Background()
+			if tt.stream {
+				ctx = WithStreamHandler(ctx, func(string) {})
+			}
+
+			if _, err := client.GetResponseFromChatMessages(ctx, []ChatMessage{{Content: "hi", FromUser: true}}, "test-model"); err != nil {
+				t.Fatalf("GetResponseFromChatMessages error: %v", err)
+			}
+
+			if got := manager.Usage.Total(); got != tt.want {
+				t.Errorf("unexpected usage: %+v, want %+v", got, tt.want)
+			}
+			if _, byModel := manager.Usage.ByModel(); byModel["main"] != tt.want {
+				t.Errorf("usage not attributed to the model configuration: %+v", byModel)
+			}
+			if last, ok := manager.Usage.Last(); !ok || last != tt.want {
+				t.Errorf("unexpected last usage: %+v", last)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package system
+
+import (
+	"sync"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Token encodings a model can choose with the tokenizer option
+const (
+	EncodingHeuristic = "heuristic"
+	EncodingCL100k    = "cl100k_base"
+	EncodingO200k     = "o200k_base"
+)
+
+// Tokenizer counts the tokens of a text the way a model would
+type Tokenizer interface {
+	Name() string
+	CountTokens(text string) int
+}
+
+// heuristicTokenizer estimates token counts from words and punctuation, see EstimateTokenCount
+type heuristicTokenizer struct{}
+
+func (heuristicTokenizer) Name() string { return EncodingHeuristic }
+
+func (heuristicTokenizer) CountTokens(text string) int { return EstimateTokenCount(text) }
+
+// bpeTokenizer counts tokens with a BPE encoding embedded in the binary
+type bpeTokenizer struct {
+	name     string
+	encoding *tiktoken.Tiktoken
+}
+
+func (t *bpeTokenizer) Name() string { return t.name }
+
+func (t *bpeTokenizer) CountTokens(text string) int {
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+var (
+	tokenizersMu sync.Mutex
+	tokenizers   = map[string]Tokenizer{}
+	loaderOnce   sync.Once
+)
+
+// GetTokenizer returns the tokenizer for an encoding. Encodings are loaded on first use,
+// unknown or empty ones fall back to the heuristic.
+func GetTokenizer(encoding string) Tokenizer {
+	if encoding == "" || encoding == EncodingHeuristic {
+		return heuristicTokenizer{}
+	}
+
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+
+	if tokenizer, ok := tokenizers[encoding]; ok {
+		return tokenizer
+	}
+
+	// Never download encodings, only the ones embedded in the binary are used
+	loaderOnce.Do(func() { tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader()) })
+
+	var tokenizer Tokenizer = heuristicTokenizer{}
+	if enc, err := tiktoken.GetEncoding(encoding); err != nil {
+		logger.Warn("Failed to load token encoding %s, using the heuristic instead: %v", encoding, err)
+	} else {
+		tokenizer = &bpeTokenizer{name: encoding, encoding: enc}
+	}
+	tokenizers[encoding] = tokenizer
+	return tokenizer
+}
@@ -0,0 +1,31 @@
+package system
+
+import "testing"
+
+func TestTokenizers(t *testing.T) {
+	tests := []struct {
+		encoding string
+		name     string
+		text     string
+		expected int
+	}{
+		{EncodingCL100k, EncodingCL100k, "tiktoken is great!", 6},
+		{EncodingO200k, EncodingO200k, "tiktoken is great!", 6},
+		{EncodingCL100k, EncodingCL100k, "これは日本語の文章です", 9},
+		{EncodingO200k, EncodingO200k, "これは日本語の文章です", 6},
+		{"", EncodingHeuristic, "tiktoken is great!", 4},
+		{"unknown_base", EncodingHeuristic, "tiktoken is great!", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding+"/"+tt.text, func(t *testing.T) {
+			tokenizer := GetTokenizer(tt.encoding)
+			if tokenizer.Name() != tt.name {
+				t.Errorf("expected tokenizer %q, got %q", tt.name, tokenizer.Name())
+			}
+			if got := tokenizer.CountTokens(tt.text); got != tt.expected {
+				t.Errorf("expected %d tokens, got %d", tt.expected, got)
+			}
+		})
+	}
+}